@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/spoonboy-io/ghost/internal/generate"
 	"github.com/spoonboy-io/ghost/internal/handlers"
+	"github.com/spoonboy-io/ghost/internal/loader"
 	"github.com/spoonboy-io/ghost/internal/mocks"
 	"github.com/spoonboy-io/ghost/mocks/remedy"
 	"github.com/spoonboy-io/koan"
 	"github.com/spoonboy-io/reprise"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
@@ -18,6 +28,34 @@ var (
 
 var logger *koan.Logger
 
+// listFlag is a flag which can be repeated or given a comma separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// headerFlag is a flag which can be repeated, a header value may contain commas so it is not split
+type headerFlag []string
+
+func (h *headerFlag) String() string {
+	return strings.Join(*h, "; ")
+}
+
+func (h *headerFlag) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
 func main() {
 	// write a console banner
 	reprise.WriteSimple(&reprise.Banner{
@@ -34,17 +72,107 @@ func main() {
 	// read port from cli -p flag or default to 9999
 	var port int
 	flag.IntVar(&port, "p", 9999, "Specify a port number (default is 9999")
+	// default response delay, fixed e.g. 250ms or a uniform range e.g. 100ms-500ms
+	var delayStr string
+	flag.StringVar(&delayStr, "delay", "", "Specify a default response delay e.g. 250ms or 100ms-500ms")
+	// default fault, a fault type optionally with the percentage of responses e.g. connection_reset:10
+	var faultStr string
+	flag.StringVar(&faultStr, "fault", "", "Specify a default fault e.g. connection_reset, empty_reply, malformed_body, trickle or stall, optionally with a percentage e.g. stall:10")
+	// chaos, a percentage of matched requests answered with an error, and the seed to reproduce them
+	var chaosPercentage float64
+	var chaosStatusCodes, chaosEndPoints string
+	var seed int64
+	flag.Float64Var(&chaosPercentage, "chaos", 0, "Specify the percentage of matched requests to answer with an error (default is 0, off)")
+	flag.StringVar(&chaosStatusCodes, "chaos-status", "", "Specify the comma separated status codes chaos responds with (default is 500,502,503,429)")
+	flag.StringVar(&chaosEndPoints, "chaos-endpoints", "", "Specify comma separated endpoint patterns chaos applies to e.g. /api/*/entry/* (default is all)")
+	flag.Int64Var(&seed, "seed", 0, "Specify a seed for random behaviour, so runs are reproducible (default is random)")
+	// mock files, globs and directories to load at startup, and whether invalid mocks are skipped
+	var mockPaths listFlag
+	var lenient bool
+	flag.Var(&mockPaths, "mocks", "Specify YAML or JSON mock files, globs or directories to load, repeated or comma separated")
+	flag.BoolVar(&lenient, "lenient", false, "Skip invalid mocks in mock files rather than refusing to start")
+	var watch bool
+	flag.BoolVar(&watch, "watch", true, "Reload mock files when they change (default is true)")
+	// the number of requests kept in the request journal
+	var journalSize int
+	flag.IntVar(&journalSize, "journal-size", 1000, "Specify the number of requests kept in the request journal (default is 1000)")
+	// the upstream unmatched requests are forwarded to, and the changes made to their headers
+	var proxyTarget string
+	var proxyAddHeaders headerFlag
+	var proxyRemoveHeaders listFlag
+	flag.StringVar(&proxyTarget, "proxy", "", "Specify an upstream base URL to forward requests no mock matches to e.g. http://localhost:8080")
+	flag.Var(&proxyAddHeaders, "proxy-header", "Specify a header to set on proxied requests as 'Name: value', repeated for each header")
+	flag.Var(&proxyRemoveHeaders, "proxy-remove-header", "Specify headers to remove from proxied requests, repeated or comma separated")
+	// the file proxied requests and responses are recorded to as mocks, and how often it is saved
+	var recordFile string
+	var recordInterval time.Duration
+	flag.StringVar(&recordFile, "record", "", "Specify a YAML, JSON or Go file to record proxied requests to as mocks e.g. mocks/recorded.yaml or mocks/upstream/upstream.go")
+	flag.DurationVar(&recordInterval, "record-interval", 2*time.Second, "Specify how often newly recorded mocks are saved, 0 saves only at shutdown (default is 2s)")
+	// the file the runtime state is saved to and restored from, and how often it is saved
+	var stateFilePath string
+	var stateInterval time.Duration
+	flag.StringVar(&stateFilePath, "state-file", "", "Specify a file to save the runtime mocks, scenario states and counters to, restored at startup")
+	flag.DurationVar(&stateInterval, "state-interval", 30*time.Second, "Specify how often the state file is saved, 0 saves only at shutdown (default is 30s)")
 	flag.Parse()
 	portStr := fmt.Sprintf(":%d", port)
 
+	defaultDelay, err := handlers.ParseDelay(delayStr)
+	if err != nil {
+		logger.FatalError("could not parse -delay flag", err)
+	}
+	defaultFault, err := handlers.ParseFault(faultStr)
+	if err != nil {
+		logger.FatalError("could not parse -fault flag", err)
+	}
+	proxy, err := handlers.ParseProxy(proxyTarget, proxyAddHeaders, proxyRemoveHeaders)
+	if err != nil {
+		logger.FatalError("could not parse -proxy flags", err)
+	}
+	if proxy != nil {
+		logger.Info(fmt.Sprintf("proxying unmatched requests to '%s'", proxy.Target))
+	}
+
+	handlers.Journal = handlers.NewRequestJournal(journalSize)
+
+	if seed != 0 {
+		handlers.Seed(seed)
+	}
+	if chaosPercentage > 0 {
+		chaos, err := handlers.ParseChaos(chaosPercentage, chaosStatusCodes, chaosEndPoints)
+		if err == nil {
+			err = handlers.Chaos.Set(chaos)
+		}
+		if err != nil {
+			logger.FatalError("could not parse -chaos flags", err)
+		}
+		logger.Warn(fmt.Sprintf("chaos enabled for %g%% of matched requests", chaosPercentage))
+	}
+
 	// handlers
 	app := &handlers.App{
-		Logger: logger,
+		Logger:       logger,
+		DefaultDelay: defaultDelay,
+		DefaultFault: defaultFault,
+		Proxy:        proxy,
+	}
+	if recordFile != "" {
+		description := "recorded from proxied requests"
+		if proxy != nil {
+			description = fmt.Sprintf("recorded from %s", proxy.Target)
+		} else {
+			logger.Warn("recording without -proxy, only requests proxied by mocks with proxyTo are recorded")
+		}
+		app.Recorder = handlers.NewRecorder(func(list []mocks.Mock) error {
+			return saveRecording(recordFile, description, list)
+		})
+		logger.Info(fmt.Sprintf("recording proxied requests to '%s'", recordFile))
 	}
 	// everything hits this endpoint
 	http.HandleFunc("/", app.Handler)
 	// except this one, where we can load mock config in realtime
 	http.HandleFunc("/load/mock", app.MockLoader)
+	// and the admin api, where we can inspect and manage the server
+	http.HandleFunc("/__admin/", app.Admin)
 
 	// as well as load mocks via the above server endpoint
 	// we have the ability to include packaged mocks for things we may reuse
@@ -55,16 +183,197 @@ func main() {
 
 	// add packaged mocks to mocksCache
 	for _, pkg := range packagedMocks {
+		// packages may provide their own match operators
+		if mp, ok := pkg.(handlers.MatcherProvider); ok {
+			for name, m := range mp.Matchers() {
+				handlers.RegisterMatcher(name, m)
+			}
+		}
+
 		pkgMocks := pkg.Mocks()
 		logger.Info(fmt.Sprintf("loading mocks from '%s' package", pkg.Name()))
 		for _, mock := range pkgMocks {
-			mockKey := fmt.Sprintf("%s-%s", mock.EndPoint, mock.Request.Verb)
-			handlers.MocksCache[mockKey] = mock
+			if mock.Source == "" {
+				mock.Source = handlers.SourcePackage + pkg.Name()
+			}
+			handlers.MocksCache.Add(mock)
 		}
 	}
 
+	// stopped by an interrupt, or by the service manager
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// add mocks from files to mocksCache, and keep them up to date as the files change
+	if len(mockPaths) > 0 {
+		fileMocks, err := readMockFiles(mockPaths, lenient)
+		if err != nil {
+			logger.FatalError("could not load mock files, use -lenient to skip invalid mocks", err)
+		}
+		handlers.MocksCache.Swap(loader.FromFile, fileMocks)
+
+		if watch {
+			go loader.Watch(ctx, mockPaths, 250*time.Millisecond, 500*time.Millisecond, func() {
+				reloadMockFiles(mockPaths, lenient)
+			})
+			logger.Info("watching mock files for changes")
+		}
+	}
+
+	// restore the mocks and state added at runtime before the server was last shut down
+	if stateFilePath != "" {
+		app.StateFile = handlers.NewStateFile(stateFilePath)
+		snap, err := app.StateFile.Load()
+		switch {
+		case os.IsNotExist(err):
+			logger.Info(fmt.Sprintf("no state file '%s' to restore, it will be created", stateFilePath))
+		case err != nil:
+			logger.FatalError("could not restore state file", err)
+		default:
+			n := handlers.RestoreSnapshot(snap)
+			logger.Info(fmt.Sprintf("restored %d mocks and state from '%s'", n, stateFilePath))
+		}
+		if stateInterval > 0 {
+			go saveStateEvery(ctx, app.StateFile, stateInterval)
+		}
+	}
+
+	// save the mocks recorded from proxied requests as they are captured
+	if app.Recorder != nil && recordInterval > 0 {
+		go saveRecordingEvery(ctx, app.Recorder, recordFile, recordInterval)
+	}
+
+	// serve until interrupted, then finish the requests in progress
+	server := &http.Server{Addr: portStr}
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		logger.Info("shutting down Ghost server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("problem shutting down server", err)
+		}
+	}()
+
 	logger.Info(fmt.Sprintf("starting Ghost server on port %s", portStr))
-	if err := http.ListenAndServe(portStr, nil); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.FatalError("failed to start server", err)
 	}
+	<-shutdown
+
+	if app.StateFile != nil {
+		saveState(app.StateFile)
+	}
+	if app.Recorder != nil {
+		flushRecording(app.Recorder, recordFile)
+	}
+}
+
+// saveStateEvery saves a snapshot of the runtime state to the state file every interval,
+// until the context is done
+func saveStateEvery(ctx context.Context, stateFile *handlers.StateFile, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			saveState(stateFile)
+		}
+	}
+}
+
+// saveState saves a snapshot of the runtime state to the state file, if it has changed
+func saveState(stateFile *handlers.StateFile) {
+	saved, err := stateFile.Save(handlers.TakeSnapshot())
+	if err != nil {
+		logger.Error("could not save state file", err)
+		return
+	}
+	if saved {
+		logger.Info(fmt.Sprintf("saved state to '%s'", stateFile.Path))
+	}
+}
+
+// saveRecordingEvery saves the mocks recorded from proxied requests every interval, until the
+// context is done
+func saveRecordingEvery(ctx context.Context, recorder *handlers.Recorder, file string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushRecording(recorder, file)
+		}
+	}
+}
+
+// flushRecording saves the recorded mocks to the file, if more have been recorded
+func flushRecording(recorder *handlers.Recorder, file string) {
+	saved, err := recorder.Flush()
+	if err != nil {
+		logger.Error("could not save recorded mocks", err)
+		return
+	}
+	if saved {
+		logger.Info(fmt.Sprintf("saved recorded mocks to '%s'", file))
+	}
+}
+
+// readMockFiles reads the mocks in the files, globs and directories, an invalid mock is an
+// error unless lenient, in which case it is skipped
+func readMockFiles(paths []string, lenient bool) ([]mocks.Mock, error) {
+	files, err := loader.Files(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMocks, errs := loader.Load(files)
+	for _, err := range errs {
+		if lenient {
+			logger.Warn(fmt.Sprintf("skipping invalid mock, %v", err))
+			continue
+		}
+		logger.Error("invalid mock", err)
+	}
+	if len(errs) > 0 && !lenient {
+		return nil, fmt.Errorf("%d errors in mock files", len(errs))
+	}
+
+	logger.Info(fmt.Sprintf("read %d mocks from %d files", len(fileMocks), len(files)))
+	return fileMocks, nil
+}
+
+// saveRecording saves the recorded mocks to the file, a Go file is written as a package of
+// mocks named for its directory, any other file is saved as YAML or JSON
+func saveRecording(file, description string, list []mocks.Mock) error {
+	if strings.ToLower(filepath.Ext(file)) != ".go" {
+		return loader.Save(file, list)
+	}
+	pkg, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+	src, err := generate.Mocker(filepath.Base(pkg), description, list)
+	if err != nil {
+		return err
+	}
+	return loader.WriteFile(file, src)
+}
+
+// reloadMockFiles swaps the mocks from files in the cache for those now in the files, the
+// previous mocks are kept if the files are invalid
+func reloadMockFiles(paths []string, lenient bool) {
+	logger.Info("mock files changed, reloading")
+	fileMocks, err := readMockFiles(paths, lenient)
+	if err != nil {
+		logger.Error("keeping the previous mocks, could not reload mock files", err)
+		return
+	}
+	handlers.MocksCache.Swap(loader.FromFile, fileMocks)
 }
@@ -3,8 +3,10 @@ module github.com/spoonboy-io/ghost
 go 1.20
 
 require (
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
 	github.com/spoonboy-io/koan v0.1.0
 	github.com/spoonboy-io/reprise v0.0.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/TwiN/go-color v1.1.0 // indirect
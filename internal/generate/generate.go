@@ -0,0 +1,191 @@
+// Package generate writes mocks as the Go source of a package of mocks, like mocks/remedy
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// statusNames are the names of the net/http constants for the common status codes, used
+// in place of the number so the generated mocks read like those written by hand
+var statusNames = map[int]string{
+	200: "StatusOK",
+	201: "StatusCreated",
+	202: "StatusAccepted",
+	204: "StatusNoContent",
+	301: "StatusMovedPermanently",
+	302: "StatusFound",
+	304: "StatusNotModified",
+	400: "StatusBadRequest",
+	401: "StatusUnauthorized",
+	403: "StatusForbidden",
+	404: "StatusNotFound",
+	405: "StatusMethodNotAllowed",
+	409: "StatusConflict",
+	422: "StatusUnprocessableEntity",
+	429: "StatusTooManyRequests",
+	500: "StatusInternalServerError",
+	502: "StatusBadGateway",
+	503: "StatusServiceUnavailable",
+	504: "StatusGatewayTimeout",
+}
+
+// Mocker returns the Go source of a package named pkg, whose exported type implements the
+// mocks.Mocker interface returning the mocks. The type is the package name capitalised, and
+// its Name is the package name
+func Mocker(pkg, description string, list []mocks.Mock) ([]byte, error) {
+	if !token.IsIdentifier(pkg) || token.IsKeyword(pkg) {
+		return nil, fmt.Errorf("'%s' is not a valid package name", pkg)
+	}
+	typeName := exportedName(pkg)
+
+	var lits bytes.Buffer
+	usesHTTP := false
+	for _, mock := range list {
+		lits.WriteString("{\n")
+		usesHTTP = writeFields(&lits, reflect.ValueOf(mock)) || usesHTTP
+		lits.WriteString("},\n")
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by ghost -record. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "// Package %s provides mocks %s\n", pkg, description)
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	src.WriteString("import (\n\"github.com/spoonboy-io/ghost/internal/mocks\"\n")
+	if usesHTTP {
+		src.WriteString("\"net/http\"\n")
+	}
+	src.WriteString(")\n\n")
+	fmt.Fprintf(&src, "// %s empty struct on which we implement the Mocker interface\n", typeName)
+	fmt.Fprintf(&src, "type %s struct{}\n\n", typeName)
+	src.WriteString("// Mocks returns the mocks to be loaded as part of this package\n")
+	fmt.Fprintf(&src, "func (%s) Mocks() []mocks.Mock {\nreturn []mocks.Mock{\n", typeName)
+	src.Write(lits.Bytes())
+	src.WriteString("}\n}\n\n")
+	src.WriteString("// Name returns the package name, which is displayed at start up\n")
+	src.WriteString("// when the packaged mocks are loaded\n")
+	fmt.Fprintf(&src, "func (%s) Name() string {\nreturn %q\n}\n", typeName, pkg)
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated source (%v)", err)
+	}
+	return out, nil
+}
+
+// writeFields writes the fields of a struct which are not empty as `Name: value,` lines, it
+// reports whether net/http is used for a status code
+func writeFields(buf *bytes.Buffer, v reflect.Value) bool {
+	usesHTTP := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if !t.Field(i).IsExported() || f.IsZero() {
+			continue
+		}
+		fmt.Fprintf(buf, "%s: ", t.Field(i).Name)
+		if t.Field(i).Name == "StatusCode" && statusNames[int(f.Int())] != "" {
+			buf.WriteString("http." + statusNames[int(f.Int())])
+			usesHTTP = true
+		} else {
+			usesHTTP = writeValue(buf, f) || usesHTTP
+		}
+		buf.WriteString(",\n")
+	}
+	return usesHTTP
+}
+
+// writeValue writes a value as a Go literal, maps within properties are written as
+// mocks.Properties as they are when written by hand
+func writeValue(buf *bytes.Buffer, v reflect.Value) bool {
+	usesHTTP := false
+	switch v.Kind() {
+	case reflect.Struct:
+		fmt.Fprintf(buf, "%s{\n", v.Type())
+		usesHTTP = writeFields(buf, v)
+		buf.WriteString("}")
+
+	case reflect.Ptr:
+		buf.WriteString("&")
+		usesHTTP = writeValue(buf, v.Elem())
+
+	case reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			break
+		}
+		elem := v.Elem()
+		if m, ok := elem.Interface().(map[string]interface{}); ok {
+			elem = reflect.ValueOf(mocks.Properties(m))
+		}
+		usesHTTP = writeValue(buf, elem)
+
+	case reflect.Map:
+		fmt.Fprintf(buf, "%s{\n", v.Type())
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s: ", strconv.Quote(k))
+			usesHTTP = writeValue(buf, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))) || usesHTTP
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("}")
+
+	case reflect.Slice:
+		fmt.Fprintf(buf, "%s{\n", v.Type())
+		for i := 0; i < v.Len(); i++ {
+			usesHTTP = writeValue(buf, v.Index(i)) || usesHTTP
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("}")
+
+	case reflect.String:
+		buf.WriteString(quote(v.String()))
+
+	case reflect.Float64:
+		// json numbers are float64, the literal keeps them so within properties
+		f := strconv.FormatFloat(v.Float(), 'g', -1, 64)
+		if !strings.ContainsAny(f, ".eIN") {
+			f += ".0"
+		}
+		buf.WriteString(f)
+
+	case reflect.Int, reflect.Int64, reflect.Bool:
+		if v.Type().PkgPath() != "" {
+			// a named type such as mocks.Duration
+			fmt.Fprintf(buf, "%s(%v)", v.Type(), v.Interface())
+			break
+		}
+		fmt.Fprintf(buf, "%v", v.Interface())
+
+	default:
+		fmt.Fprintf(buf, "%#v", v.Interface())
+	}
+	return usesHTTP
+}
+
+// quote quotes a string, as a raw string where that is easier to read, such as json
+func quote(s string) string {
+	if strings.Contains(s, `"`) && !strings.ContainsAny(s, "`\r") && strconv.CanBackquote(strings.ReplaceAll(s, "\n", "")) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// exportedName capitalises the first letter of a name
+func exportedName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,96 @@
+package generate
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestMocker(t *testing.T) {
+	list := []mocks.Mock{
+		{
+			ID:       "post-api-jwt-login",
+			EndPoint: "/api/jwt/login",
+			Request: mocks.Request{
+				Verb:    "POST",
+				Headers: mocks.Properties{"Authorization": map[string]interface{}{"$regex": "^AR-JWT .+"}},
+				Body:    mocks.Properties{"username": "admin", "attempts": 3.0, "tags": []interface{}{"a", true}},
+			},
+			Response: mocks.Response{
+				StatusCode: 200,
+				RawBody:    `{"token": "abc"}`,
+				Delay:      &mocks.Delay{Fixed: mocks.Duration(250000000)},
+			},
+		},
+		{
+			ID:       "get-teapot",
+			EndPoint: "/teapot",
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{StatusCode: 418, RawBody: "short\nand stout"},
+		},
+	}
+
+	testCases := []struct {
+		Name     string
+		Pkg      string
+		Mocks    []mocks.Mock
+		WantText []string
+		WantErr  bool
+	}{
+		{
+			Name:  "Package of mocks",
+			Pkg:   "upstream",
+			Mocks: list,
+			WantText: []string{
+				"// Code generated by ghost -record. DO NOT EDIT.",
+				"package upstream",
+				`"net/http"`,
+				"type Upstream struct{}",
+				"func (Upstream) Mocks() []mocks.Mock {",
+				`ID:       "post-api-jwt-login",`,
+				`"Authorization": mocks.Properties{`,
+				`"attempts": 3.0,`,
+				`"tags": []interface{}{`,
+				"StatusCode: http.StatusOK,",
+				"RawBody:    `{\"token\": \"abc\"}`,",
+				"Delay: &mocks.Delay{",
+				"Fixed: mocks.Duration(250000000),",
+				"StatusCode: 418,",
+				`RawBody:    "short\nand stout",`,
+				`return "upstream"`,
+			},
+		},
+		{
+			Name:     "No mocks",
+			Pkg:      "empty",
+			WantText: []string{"return []mocks.Mock{}"},
+		},
+		{Name: "Invalid package name", Pkg: "my-upstream", WantErr: true},
+		{Name: "Keyword package name", Pkg: "func", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			src, err := Mocker(tc.Pkg, "recorded from https://example.com", tc.Mocks)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wrong error: got %v want error %v", err, tc.WantErr)
+			}
+			if tc.WantErr {
+				return
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "mocks.go", src, 0); err != nil {
+				t.Fatalf("generated source does not parse: %v\n%s", err, src)
+			}
+			for _, want := range tc.WantText {
+				if !strings.Contains(string(src), want) {
+					t.Errorf("generated source should contain %q, got\n%s", want, src)
+				}
+			}
+			if len(tc.Mocks) == 0 && strings.Contains(string(src), `"net/http"`) {
+				t.Errorf("net/http should not be imported when unused")
+			}
+		})
+	}
+}
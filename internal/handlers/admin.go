@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScenarioStatus describes the current state of a scenario
+type ScenarioStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// ScenariosResponse is the response of the admin scenarios endpoints
+type ScenariosResponse struct {
+	Scenarios []ScenarioStatus `json:"scenarios"`
+}
+
+// MocksResponse is the response of the admin mocks endpoints which list mocks
+type MocksResponse struct {
+	Mocks []mocks.Mock `json:"mocks"`
+}
+
+// CountersResponse is the response of the admin counters endpoint, it has the named
+// counters used by response templates and the number of calls matched by each mock
+type CountersResponse struct {
+	Counters  map[string]int `json:"counters"`
+	MockCalls map[string]int `json:"mockCalls"`
+}
+
+// Admin is the handler for the admin api, which is served under `/__admin/`
+//
+//	GET    /__admin/scenarios               list the scenarios and their current state
+//	POST   /__admin/scenarios/reset         return all scenarios to the `Started` state
+//	PUT    /__admin/scenarios/{name}/state  set the state of a scenario, body `{"state": "..."}`
+//	POST   /__admin/scenarios/{name}/reset  return a scenario to the `Started` state
+//	GET    /__admin/counters                list the template counters and mock call counters
+//	DELETE /__admin/counters                reset all counters, restarting response sequences
+//	GET    /__admin/mocks                   list the mocks, filtered by `?endPoint=` (a glob pattern), `verb` and `source`
+//	DELETE /__admin/mocks                   remove all mocks
+//	GET    /__admin/mocks/{id}              fetch a mock
+//	PUT    /__admin/mocks/{id}              add or replace a mock, body is the mock
+//	DELETE /__admin/mocks/{id}              remove a mock
+//	GET    /__admin/requests                list the journal of requests received, oldest first, filtered by
+//	                                        `?method=`, `path` (a glob pattern), `mockId`, `matched`, `proxied`, `since`
+//	                                        and `limit` (the most recent n)
+//	DELETE /__admin/requests                clear the journal
+//	GET    /__admin/requests/unmatched      list the requests which no mock matched, with the same filters
+//	POST   /__admin/requests/verify         verify the journal has requests matching a pattern, body is a VerifyRequest
+//	GET    /__admin/chaos                   show the chaos setting
+//	PUT    /__admin/chaos                   enable chaos, body is a ChaosConfig
+//	DELETE /__admin/chaos                   disable chaos
+//	GET    /__admin/recordings              list the mocks recorded from proxied requests
+//	DELETE /__admin/recordings              discard the recorded mocks, recording starts again
+//	POST   /__admin/snapshot                take a snapshot of the runtime state, saved to the state file if set
+func (a *App) Admin(w http.ResponseWriter, r *http.Request) {
+	msg := fmt.Sprintf("admin request '%s %s'", r.Method, r.URL)
+	a.Logger.Info(msg)
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/__admin"), "/"), "/")
+	switch parts[0] {
+	case "scenarios":
+		a.adminScenarios(w, r, parts[1:])
+	case "counters":
+		a.adminCounters(w, r, parts[1:])
+	case "mocks":
+		a.adminMocks(w, r, parts[1:])
+	case "requests":
+		a.adminRequests(w, r, parts[1:])
+	case "chaos":
+		a.adminChaos(w, r, parts[1:])
+	case "recordings":
+		a.adminRecordings(w, r, parts[1:])
+	case "snapshot":
+		a.adminSnapshot(w, r, parts[1:])
+	default:
+		a.writeError(w, http.StatusNotFound, fmt.Sprintf("No admin endpoint for Url:%s", r.URL))
+	}
+}
+
+// adminScenarios inspects and resets scenario state
+func (a *App) adminScenarios(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		// list, below
+
+	case len(parts) == 1 && parts[0] == "reset" && r.Method == http.MethodPost:
+		State.ResetScenarios()
+		a.Logger.Info("reset all scenarios")
+
+	case len(parts) == 2 && parts[1] == "reset" && r.Method == http.MethodPost:
+		State.ResetScenario(parts[0])
+		a.Logger.Info(fmt.Sprintf("reset scenario '%s'", parts[0]))
+
+	case len(parts) == 2 && parts[1] == "state" && r.Method == http.MethodPut:
+		var req ScenarioStatus
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err == nil {
+			err = json.Unmarshal(body, &req)
+		}
+		if err != nil || req.State == "" {
+			a.writeError(w, http.StatusBadRequest, "Request body should be json with a non empty 'state'")
+			return
+		}
+		State.SetScenarioState(parts[0], req.State)
+		a.Logger.Info(fmt.Sprintf("set scenario '%s' to state '%s'", parts[0], req.State))
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, ScenariosResponse{Scenarios: scenarioStatuses()})
+}
+
+// adminCounters inspects and resets counters
+func (a *App) adminCounters(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		// list, below
+
+	case len(parts) == 0 && r.Method == http.MethodDelete:
+		State.ResetCounters()
+		a.Logger.Info("reset all counters")
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, CountersResponse{
+		Counters:  State.Counters(),
+		MockCalls: State.Calls(),
+	})
+}
+
+// adminMocks lists, fetches, replaces and removes cached mocks
+func (a *App) adminMocks(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		a.writeJSON(w, http.StatusOK, MocksResponse{Mocks: filterMocks(MocksCache.Mocks(), r.URL.Query())})
+
+	case len(parts) == 0 && r.Method == http.MethodDelete:
+		MocksCache.Reset()
+		a.Logger.Info("removed all mocks")
+		a.writeJSON(w, http.StatusOK, MocksResponse{Mocks: []mocks.Mock{}})
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		mock, ok := MocksCache.Get(parts[0])
+		if !ok {
+			a.writeError(w, http.StatusNotFound, fmt.Sprintf("No mock with id '%s'", parts[0]))
+			return
+		}
+		a.writeJSON(w, http.StatusOK, mock)
+
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var mock mocks.Mock
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err == nil {
+			err = json.Unmarshal(body, &mock)
+		}
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, fmt.Sprintf("Request body should be a json mock (%v)", err))
+			return
+		}
+		if errs := mock.ValidateRemote(); len(errs) > 0 {
+			a.writeJSON(w, http.StatusBadRequest, MockErrorResponse{
+				StatusCode: http.StatusBadRequest,
+				Status:     http.StatusText(http.StatusBadRequest),
+				Detail:     "Mock is invalid",
+				Errors:     errs,
+			})
+			return
+		}
+
+		mock.ID = parts[0]
+		if mock.Source == "" {
+			mock.Source = SourceAPI
+		}
+		status := http.StatusCreated
+		if _, ok := MocksCache.Get(mock.ID); ok {
+			status = http.StatusOK
+		}
+		MocksCache.Put(mock)
+		a.Logger.Info(fmt.Sprintf("put mock '%s' (%s)", mockKey(mock), mock.ID))
+		a.writeJSON(w, status, mock)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		mock, ok := MocksCache.Remove(parts[0])
+		if !ok {
+			a.writeError(w, http.StatusNotFound, fmt.Sprintf("No mock with id '%s'", parts[0]))
+			return
+		}
+		a.Logger.Info(fmt.Sprintf("removed mock '%s' (%s)", mockKey(mock), mock.ID))
+		a.writeJSON(w, http.StatusOK, mock)
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+	}
+}
+
+// filterMocks returns the mocks whose endpoint matches the `endPoint` glob pattern, whose
+// verb is the `verb` and whose source is the `source`, where those filters are given
+func filterMocks(list []mocks.Mock, filters url.Values) []mocks.Mock {
+	endPoint, verb, source := filters.Get("endPoint"), filters.Get("verb"), filters.Get("source")
+
+	filtered := []mocks.Mock{}
+	for _, mock := range list {
+		if endPoint != "" {
+			if ok, _ := path.Match(endPoint, mock.EndPoint); !ok {
+				continue
+			}
+		}
+		if verb != "" && !strings.EqualFold(verb, mock.Request.Verb) {
+			continue
+		}
+		if source != "" && source != mock.Source {
+			continue
+		}
+		filtered = append(filtered, mock)
+	}
+	return filtered
+}
+
+// adminRequests queries and clears the request journal
+func (a *App) adminRequests(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case (len(parts) == 0 || (len(parts) == 1 && parts[0] == "unmatched")) && r.Method == http.MethodGet:
+		query := r.URL.Query()
+		if len(parts) == 1 {
+			query.Set("matched", "false")
+		}
+		filter, err := journalFilter(query)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		entries := Journal.Entries(filter)
+		total := len(entries)
+		if s := query.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit < 0 {
+				a.writeError(w, http.StatusBadRequest, fmt.Sprintf("limit should be a positive number, got '%s'", s))
+				return
+			}
+			if limit < len(entries) {
+				entries = entries[len(entries)-limit:]
+			}
+		}
+		a.writeJSON(w, http.StatusOK, RequestsResponse{Requests: entries, Total: total})
+
+	case len(parts) == 1 && parts[0] == "verify" && r.Method == http.MethodPost:
+		var v VerifyRequest
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err == nil {
+			err = json.Unmarshal(body, &v)
+		}
+		if err != nil || (v.EndPoint == "" && len(v.InOrder) == 0) {
+			a.writeError(w, http.StatusBadRequest, "Request body should be json with an 'endPoint' or 'inOrder' patterns")
+			return
+		}
+		res := verify(v, Journal.Entries(nil))
+		if !res.Passed {
+			a.Logger.Warn(fmt.Sprintf("verification failed, %s", strings.Join(res.Failures, "; ")))
+		}
+		a.writeJSON(w, http.StatusOK, res)
+
+	case len(parts) == 0 && r.Method == http.MethodDelete:
+		Journal.Reset()
+		a.Logger.Info("cleared the request journal")
+		a.writeJSON(w, http.StatusOK, RequestsResponse{Requests: []JournalEntry{}})
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+	}
+}
+
+// adminChaos inspects and changes the chaos setting
+func (a *App) adminChaos(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		// show, below
+
+	case len(parts) == 0 && r.Method == http.MethodPut:
+		var config ChaosConfig
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err == nil {
+			err = json.Unmarshal(body, &config)
+		}
+		if err == nil {
+			err = Chaos.Set(config)
+		}
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, fmt.Sprintf("Request body should be a valid chaos config (%v)", err))
+			return
+		}
+		a.Logger.Warn(fmt.Sprintf("chaos enabled for %g%% of matched requests", config.Percentage))
+
+	case len(parts) == 0 && r.Method == http.MethodDelete:
+		Chaos.Disable()
+		a.Logger.Info("chaos disabled")
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+		return
+	}
+
+	res := ChaosResponse{}
+	if config, ok := Chaos.Get(); ok {
+		res.Enabled = true
+		res.Chaos = &config
+	}
+	a.writeJSON(w, http.StatusOK, res)
+}
+
+// adminRecordings inspects and discards the mocks recorded from proxied requests
+func (a *App) adminRecordings(w http.ResponseWriter, r *http.Request, parts []string) {
+	if a.Recorder == nil {
+		a.writeError(w, http.StatusNotFound, "Recording is not enabled, start the server with -record")
+		return
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		// list, below
+
+	case len(parts) == 0 && r.Method == http.MethodDelete:
+		a.Recorder.Reset()
+		if _, err := a.Recorder.Flush(); err != nil {
+			a.Logger.Error("could not save recorded mocks", err)
+		}
+		a.Logger.Info("discarded recorded mocks")
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, MocksResponse{Mocks: a.Recorder.Mocks()})
+}
+
+// adminSnapshot takes a snapshot of the runtime state, the response is the snapshot
+func (a *App) adminSnapshot(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 0 || r.Method != http.MethodPost {
+		a.writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for Url:%s", r.Method, r.URL))
+		return
+	}
+
+	snap := TakeSnapshot()
+	if a.StateFile != nil {
+		if _, err := a.StateFile.Save(snap); err != nil {
+			a.Logger.Error("could not save snapshot", err)
+			a.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Could not save snapshot to '%s' (%v)", a.StateFile.Path, err))
+			return
+		}
+		a.Logger.Info(fmt.Sprintf("saved snapshot of %d mocks to '%s'", len(snap.Mocks), a.StateFile.Path))
+	}
+	a.writeJSON(w, http.StatusOK, snap)
+}
+
+// scenarioStatuses returns the state of each scenario used by the cached mocks,
+// and of any other scenario whose state has been set
+func scenarioStatuses() []ScenarioStatus {
+	states := State.Scenarios()
+	names := MocksCache.Scenarios()
+	for name := range states {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	statuses := make([]ScenarioStatus, 0, len(names))
+	for _, name := range names {
+		state, ok := states[name]
+		if !ok {
+			state = ScenarioStarted
+		}
+		statuses = append(statuses, ScenarioStatus{Name: name, State: state})
+	}
+	return statuses
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes the value as a json response with the status code
+func (a *App) writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		a.Logger.Error("problem marshaling response", err)
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(out)
+}
+
+// writeError writes a MockErrorResponse with the status code and detail
+func (a *App) writeError(w http.ResponseWriter, statusCode int, detail string) {
+	a.writeJSON(w, statusCode, MockErrorResponse{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Detail:     detail,
+	})
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// doRequest serves a request with the handler and returns the recorded response
+func doRequest(t *testing.T, handler http.HandlerFunc, method, url string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdminScenarios(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+
+	status := func(id, required, newState, approval string) mocks.Mock {
+		return mocks.Mock{
+			ID:            id,
+			Scenario:      "approval",
+			RequiredState: required,
+			NewState:      newState,
+			EndPoint:      "/scenario/status",
+			Request:       mocks.Request{Verb: "GET"},
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				RawBody:    approval,
+			},
+		}
+	}
+	MocksCache.Add(status("pending-1", ScenarioStarted, "Polled once", "Pending"))
+	MocksCache.Add(status("pending-2", "Polled once", "Polled twice", "Pending"))
+	MocksCache.Add(status("approved", "Polled twice", "", "Approved"))
+
+	poll := func(want string) {
+		t.Helper()
+		rr := doRequest(t, app.Handler, "GET", "/scenario/status", nil)
+		if got := rr.Body.String(); got != want {
+			t.Errorf("wrong scenario response: got %v want %v", got, want)
+		}
+	}
+	scenarioState := func(rr *httptest.ResponseRecorder) string {
+		t.Helper()
+		var res ScenariosResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range res.Scenarios {
+			if s.Name == "approval" {
+				return s.State
+			}
+		}
+		t.Fatal("scenario not listed")
+		return ""
+	}
+
+	poll("Pending")
+	poll("Pending")
+	poll("Approved")
+	poll("Approved")
+
+	rr := doRequest(t, app.Admin, "GET", "/__admin/scenarios", nil)
+	if got := scenarioState(rr); got != "Polled twice" {
+		t.Errorf("wrong scenario state: got %v want %v", got, "Polled twice")
+	}
+
+	rr = doRequest(t, app.Admin, "POST", "/__admin/scenarios/approval/reset", nil)
+	if got := scenarioState(rr); got != ScenarioStarted {
+		t.Errorf("wrong scenario state after reset: got %v want %v", got, ScenarioStarted)
+	}
+	poll("Pending")
+
+	rr = doRequest(t, app.Admin, "PUT", "/__admin/scenarios/approval/state", []byte(`{"state": "Polled twice"}`))
+	if got := scenarioState(rr); got != "Polled twice" {
+		t.Errorf("wrong scenario state after set: got %v want %v", got, "Polled twice")
+	}
+	poll("Approved")
+
+	rr = doRequest(t, app.Admin, "POST", "/__admin/scenarios/reset", nil)
+	if got := scenarioState(rr); got != ScenarioStarted {
+		t.Errorf("wrong scenario state after reset all: got %v want %v", got, ScenarioStarted)
+	}
+
+	rr = doRequest(t, app.Admin, "PUT", "/__admin/scenarios/approval/state", []byte(`{}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wrong status code for bad state: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = doRequest(t, app.Admin, "GET", "/__admin/unknown", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("wrong status code for unknown endpoint: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestResponseSequences(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+
+	sequence := func(id, mode string) mocks.Mock {
+		return mocks.Mock{
+			ID:           id,
+			Priority:     1,
+			EndPoint:     "/sequence/" + mode,
+			Request:      mocks.Request{Verb: "GET"},
+			SequenceMode: mode,
+			Responses: []mocks.Response{
+				{StatusCode: http.StatusAccepted, RawBody: "first"},
+				{StatusCode: http.StatusOK, RawBody: "second"},
+			},
+		}
+	}
+	MocksCache.Add(sequence("sequence-stick", mocks.SequenceStick))
+	MocksCache.Add(sequence("sequence-cycle", mocks.SequenceCycle))
+	MocksCache.Add(sequence("sequence-fallthrough", mocks.SequenceFallThrough))
+	MocksCache.Add(mocks.Mock{
+		ID:       "sequence-fallback",
+		EndPoint: "/sequence/fallthrough",
+		Request:  mocks.Request{Verb: "GET"},
+		Response: mocks.Response{StatusCode: http.StatusServiceUnavailable, RawBody: "fallback"},
+	})
+	State.ResetCounters()
+
+	testCases := []struct {
+		Name  string
+		URL   string
+		Wants []string
+	}{
+		{Name: "Stick on the last response", URL: "/sequence/stick", Wants: []string{"first", "second", "second"}},
+		{Name: "Cycle through the responses", URL: "/sequence/cycle", Wants: []string{"first", "second", "first"}},
+		{Name: "Fall through to the next candidate", URL: "/sequence/fallthrough", Wants: []string{"first", "second", "fallback"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			for _, want := range tc.Wants {
+				rr := doRequest(t, app.Handler, "GET", tc.URL, nil)
+				if got := rr.Body.String(); got != want {
+					t.Errorf("wrong response in sequence: got %v want %v", got, want)
+				}
+			}
+		})
+	}
+
+	rr := doRequest(t, app.Admin, "GET", "/__admin/counters", nil)
+	var res CountersResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.MockCalls["sequence-fallthrough"]; got != 2 {
+		t.Errorf("wrong mock call count: got %v want %v", got, 2)
+	}
+	if got := res.MockCalls["sequence-fallback"]; got != 1 {
+		t.Errorf("wrong mock call count: got %v want %v", got, 1)
+	}
+
+	doRequest(t, app.Admin, "DELETE", "/__admin/counters", nil)
+	rr = doRequest(t, app.Handler, "GET", "/sequence/stick", nil)
+	if got := rr.Body.String(); got != "first" {
+		t.Errorf("wrong response after counters reset: got %v want %v", got, "first")
+	}
+}
+
+func TestAdminMocks(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+
+	MocksCache.Add(mocks.Mock{ID: "login", Source: "package:remedy", EndPoint: "/api/jwt/login", Request: mocks.Request{Verb: "POST"}})
+	MocksCache.Add(mocks.Mock{ID: "logout", Source: "package:remedy", EndPoint: "/api/jwt/logout", Request: mocks.Request{Verb: "POST"}})
+	MocksCache.Add(mocks.Mock{ID: "entry", EndPoint: "/api/arsys/v1/entry/{form}", Request: mocks.Request{Verb: "GET"}})
+
+	listed := func(rr *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var res MocksResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, mock := range res.Mocks {
+			ids = append(ids, mock.ID)
+		}
+		return ids
+	}
+
+	testCases := []struct {
+		Name       string
+		Method     string
+		URL        string
+		Body       string
+		WantStatus int
+		WantIDs    []string
+		WantID     string
+	}{
+		{Name: "List all", Method: "GET", URL: "/__admin/mocks", WantStatus: http.StatusOK, WantIDs: []string{"login", "logout", "entry"}},
+		{Name: "Filter by endpoint", Method: "GET", URL: "/__admin/mocks?endPoint=/api/jwt/*", WantStatus: http.StatusOK, WantIDs: []string{"login", "logout"}},
+		{Name: "Filter by verb", Method: "GET", URL: "/__admin/mocks?verb=get", WantStatus: http.StatusOK, WantIDs: []string{"entry"}},
+		{Name: "Filter by source", Method: "GET", URL: "/__admin/mocks?source=package:remedy&endPoint=/api/jwt/login", WantStatus: http.StatusOK, WantIDs: []string{"login"}},
+		{Name: "Fetch", Method: "GET", URL: "/__admin/mocks/entry", WantStatus: http.StatusOK, WantID: "entry"},
+		{Name: "Fetch missing", Method: "GET", URL: "/__admin/mocks/missing", WantStatus: http.StatusNotFound},
+		{
+			Name:       "Put new",
+			Method:     "PUT",
+			URL:        "/__admin/mocks/status",
+			Body:       `{"endPoint": "/status", "request": {"verb": "GET"}, "response": {"status": 200}}`,
+			WantStatus: http.StatusCreated,
+			WantID:     "status",
+		},
+		{
+			Name:       "Put replacement",
+			Method:     "PUT",
+			URL:        "/__admin/mocks/status",
+			Body:       `{"endPoint": "/status", "request": {"verb": "GET"}, "response": {"status": 503}}`,
+			WantStatus: http.StatusOK,
+			WantID:     "status",
+		},
+		{
+			Name:       "Put invalid",
+			Method:     "PUT",
+			URL:        "/__admin/mocks/status",
+			Body:       `{"endPoint": "/status", "request": {"verb": "GET"}, "response": {"status": 0}}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		{Name: "Delete", Method: "DELETE", URL: "/__admin/mocks/logout", WantStatus: http.StatusOK, WantID: "logout"},
+		{Name: "Delete missing", Method: "DELETE", URL: "/__admin/mocks/logout", WantStatus: http.StatusNotFound},
+		{Name: "List after changes", Method: "GET", URL: "/__admin/mocks", WantStatus: http.StatusOK, WantIDs: []string{"login", "entry", "status"}},
+		{Name: "Reset", Method: "DELETE", URL: "/__admin/mocks", WantStatus: http.StatusOK, WantIDs: []string{}},
+		{Name: "List after reset", Method: "GET", URL: "/__admin/mocks", WantStatus: http.StatusOK, WantIDs: []string{}},
+		{Name: "Not allowed", Method: "POST", URL: "/__admin/mocks", WantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.Admin, tc.Method, tc.URL, []byte(tc.Body))
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+			if tc.WantIDs != nil {
+				if got := listed(rr); !reflect.DeepEqual(got, tc.WantIDs) {
+					t.Errorf("wrong mocks listed: got %v want %v", got, tc.WantIDs)
+				}
+			}
+			if tc.WantID != "" {
+				var mock mocks.Mock
+				if err := json.Unmarshal(rr.Body.Bytes(), &mock); err != nil {
+					t.Fatal(err)
+				}
+				if mock.ID != tc.WantID {
+					t.Errorf("wrong mock: got %v want %v", mock.ID, tc.WantID)
+				}
+			}
+		})
+	}
+
+	// a mock put through the api is tagged with its source
+	MocksCache.Add(mocks.Mock{ID: "tagged", EndPoint: "/tagged", Request: mocks.Request{Verb: "GET"}})
+	rr := doRequest(t, app.Admin, "PUT", "/__admin/mocks/tagged", []byte(`{"endPoint": "/tagged", "request": {"verb": "GET"}, "response": {"status": 200}}`))
+	var mock mocks.Mock
+	if err := json.Unmarshal(rr.Body.Bytes(), &mock); err != nil {
+		t.Fatal(err)
+	}
+	if mock.Source != SourceAPI {
+		t.Errorf("wrong source: got %v want %v", mock.Source, SourceAPI)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// rawBody returns the raw body of the response, if it has one, in order of precedence
+// RawBody (rendered as a template if the response is templated), Base64Body, then the
+// contents of BodyFile. The boolean is false when the response has only a structured body
+func rawBody(response mocks.Response, data templateData) ([]byte, bool, error) {
+	switch {
+	case response.RawBody != "" && !response.Template:
+		return []byte(response.RawBody), true, nil
+	case response.RawBody != "":
+		out, err := renderString(response.RawBody, data)
+		return []byte(out), true, err
+	case response.Base64Body != "":
+		out, err := base64.StdEncoding.DecodeString(response.Base64Body)
+		return out, true, err
+	case response.BodyFile != "":
+		out, err := os.ReadFile(response.BodyFile)
+		return out, true, err
+	}
+	return nil, false, nil
+}
+
+// detectContentType is used when a raw body is served without a declared content type,
+// a body file is typed by its extension and anything else by sniffing the content
+func detectContentType(bodyFile string, body []byte) string {
+	if bodyFile != "" {
+		if ct := mime.TypeByExtension(filepath.Ext(bodyFile)); ct != "" {
+			return ct
+		}
+	}
+	return http.DetectContentType(body)
+}
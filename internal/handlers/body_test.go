@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteResponseBody(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	bodyFile := filepath.Join(t.TempDir(), "status.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"status":"Approved"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name            string
+		Response        mocks.Response
+		WantStatusCode  int
+		WantBody        []byte
+		WantContentType string
+	}{
+		{
+			Name: "Raw body, top level array with declared content type",
+			Response: mocks.Response{
+				StatusCode: http.StatusUnauthorized,
+				Headers:    mocks.Properties{"Content-Type": "application/json"},
+				RawBody:    `[{"messageType":"ERROR"}]`,
+			},
+			WantBody:        []byte(`[{"messageType":"ERROR"}]`),
+			WantContentType: "application/json",
+		},
+		{
+			Name: "Raw body, templated",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "text/html"},
+				RawBody:    "<p>{{ .Path.id }}</p>",
+				Template:   true,
+			},
+			WantBody:        []byte("<p>42</p>"),
+			WantContentType: "text/html",
+		},
+		{
+			Name: "Raw body, not templated so served as it is",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "text/html"},
+				RawBody:    "<p>{{name}} {{ .Path.id</p>",
+			},
+			WantBody:        []byte("<p>{{name}} {{ .Path.id</p>"),
+			WantContentType: "text/html",
+		},
+		{
+			Name: "Raw body, templated but does not parse, server error",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "text/html"},
+				RawBody:    "<p>{{ .Path.id</p>",
+				Template:   true,
+			},
+			WantStatusCode:  http.StatusInternalServerError,
+			WantContentType: "application/json",
+		},
+		{
+			Name: "Base64 body, binary content sniffed",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Base64Body: "iVBORw0KGgoAAAANSUhEUg==",
+			},
+			WantBody:        png,
+			WantContentType: "image/png",
+		},
+		{
+			Name: "Body file, typed by extension",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				BodyFile:   bodyFile,
+			},
+			WantBody:        []byte(`{"status":"Approved"}`),
+			WantContentType: "application/json",
+		},
+		{
+			Name: "Base64 body which does not decode, server error",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Base64Body: "not base64!",
+			},
+			WantStatusCode:  http.StatusInternalServerError,
+			WantBody:        []byte(`{"statusCode":500,"status":"Internal Server Error","detail":"Could not load the raw body of the mock response (illegal base64 data at input byte 3)"}`),
+			WantContentType: "application/json",
+		},
+		{
+			Name: "Body file missing, server error",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "text/html"},
+				BodyFile:   filepath.Join(filepath.Dir(bodyFile), "missing.html"),
+			},
+			WantStatusCode:  http.StatusInternalServerError,
+			WantContentType: "application/json",
+		},
+		{
+			Name: "Structured body",
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "application/json"},
+				Body:       mocks.Properties{"id": "{{ .Path.id }}"},
+			},
+			WantBody:        []byte(`{"id":"42"}`),
+			WantContentType: "application/json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/items/42", nil)
+			rr := httptest.NewRecorder()
+			app := &App{
+				Logger: &koan.Logger{},
+			}
+
+			app.writeResponse(rr, tc.Response, newTemplateData(req, map[string]string{"id": "42"}, nil))
+
+			wantStatusCode := tc.WantStatusCode
+			if wantStatusCode == 0 {
+				wantStatusCode = tc.Response.StatusCode
+			}
+			if rr.Code != wantStatusCode {
+				t.Errorf("wrong status code: got %v want %v", rr.Code, wantStatusCode)
+			}
+			// the detail of an error holds the path of the missing file
+			if tc.WantBody != nil && !bytes.Equal(rr.Body.Bytes(), tc.WantBody) {
+				t.Errorf("wrong body: got %q want %q", rr.Body.Bytes(), tc.WantBody)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.WantContentType {
+				t.Errorf("wrong content type: got %v want %v", got, tc.WantContentType)
+			}
+		})
+	}
+}
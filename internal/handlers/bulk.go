@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"strconv"
+)
+
+// MockBundle is a named set of mocks loaded in one request, when Transactional the mocks
+// are only cached if all of them are valid
+type MockBundle struct {
+	Name          string            `json:"name"`
+	Transactional bool              `json:"transactional,omitempty"`
+	Mocks         []json.RawMessage `json:"mocks"`
+}
+
+// MockLoadResult is the outcome of loading one mock of a bundle, the Index is its position
+// in the bundle and the ID is assigned when the mock is cached
+type MockLoadResult struct {
+	Index  int                `json:"index"`
+	ID     string             `json:"id,omitempty"`
+	Status string             `json:"status"`
+	Errors []mocks.FieldError `json:"errors,omitempty"`
+}
+
+// MockBundleResponse is the response when a bundle or array of mocks is loaded, it has a
+// result for each mock
+type MockBundleResponse struct {
+	StatusCode int              `json:"statusCode"`
+	Status     string           `json:"status"`
+	Name       string           `json:"name,omitempty"`
+	Loaded     int              `json:"loaded"`
+	Results    []MockLoadResult `json:"results"`
+}
+
+// Mock load result statuses
+const (
+	resultCreated  = "created"
+	resultReplaced = "replaced"
+	resultInvalid  = "invalid"
+	resultSkipped  = "skipped"
+)
+
+// isBulk reports whether the request body holds an array of mocks or a bundle, rather
+// than a single mock
+func isBulk(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return false
+	}
+	if body[0] == '[' {
+		return true
+	}
+	var probe struct {
+		Mocks json.RawMessage `json:"mocks"`
+	}
+	return json.Unmarshal(body, &probe) == nil && probe.Mocks != nil
+}
+
+// loadBulk loads an array of mocks or a bundle. Each mock is validated and has a result,
+// the valid mocks are cached together, unless the load is transactional and a mock is
+// invalid in which case none are. An array is transactional with `?transactional=true`
+func (a *App) loadBulk(w http.ResponseWriter, r *http.Request, body []byte) {
+	bundle := MockBundle{}
+	var err error
+	if bytes.TrimSpace(body)[0] == '[' {
+		err = json.Unmarshal(body, &bundle.Mocks)
+		bundle.Transactional, _ = strconv.ParseBool(r.URL.Query().Get("transactional"))
+	} else {
+		err = json.Unmarshal(body, &bundle)
+	}
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Sprintf("Request body should be an array or bundle of json mocks (%v)", err))
+		return
+	}
+
+	source := SourceAPI
+	if bundle.Name != "" {
+		source = "bundle:" + bundle.Name
+	}
+
+	res := MockBundleResponse{Name: bundle.Name, Results: make([]MockLoadResult, len(bundle.Mocks))}
+	var valid []mocks.Mock
+	var validIndexes []int
+	for i, raw := range bundle.Mocks {
+		res.Results[i] = MockLoadResult{Index: i, Status: resultInvalid}
+
+		mock := mocks.Mock{}
+		if err := json.Unmarshal(raw, &mock); err != nil {
+			res.Results[i].Errors = []mocks.FieldError{{Field: fmt.Sprintf("mocks[%d]", i), Message: err.Error()}}
+			continue
+		}
+		if errs := mock.ValidateRemote(); len(errs) > 0 {
+			res.Results[i].Errors = errs
+			continue
+		}
+
+		if mock.Source == "" {
+			mock.Source = source
+		}
+		valid = append(valid, mock)
+		validIndexes = append(validIndexes, i)
+	}
+
+	invalid := len(bundle.Mocks) - len(valid)
+	if bundle.Transactional && invalid > 0 {
+		for _, i := range validIndexes {
+			res.Results[i].Status = resultSkipped
+		}
+		valid = nil
+	}
+
+	// the mocks are cached together so requests never see part of the bundle
+	// a mock replacing another is reported as such, as it is by the single mock loader
+	ids, replaced := MocksCache.PutAll(valid)
+	created := 0
+	for n, id := range ids {
+		i := validIndexes[n]
+		res.Results[i].ID = id
+		if replaced[n] {
+			res.Results[i].Status = resultReplaced
+			a.Logger.Info(fmt.Sprintf("replaced mock '%s' (%s)", mockKey(valid[n]), id))
+			continue
+		}
+		res.Results[i].Status = resultCreated
+		created++
+		a.Logger.Info(fmt.Sprintf("added new mock '%s' (%s)", mockKey(valid[n]), id))
+	}
+	res.Loaded = len(ids)
+
+	switch {
+	case invalid == 0 && created == 0 && res.Loaded > 0:
+		res.StatusCode = http.StatusOK
+	case invalid == 0:
+		res.StatusCode = http.StatusCreated
+	case res.Loaded == 0:
+		res.StatusCode = http.StatusBadRequest
+	default:
+		res.StatusCode = http.StatusMultiStatus
+	}
+	res.Status = http.StatusText(res.StatusCode)
+	a.writeJSON(w, res.StatusCode, res)
+}
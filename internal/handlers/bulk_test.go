@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMockLoaderBulk(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+
+	const (
+		good    = `{"id": "bulk-%d", "endPoint": "/bulk/%d", "request": {"verb": "GET"}, "response": {"status": 200}}`
+		badVerb = `{"endPoint": "/bulk/bad", "request": {"verb": "FETCH"}, "response": {"status": 200}}`
+		badJSON = `{"endPoint": 42}`
+	)
+
+	testCases := []struct {
+		Name         string
+		URL          string
+		Body         string
+		WantStatus   int
+		WantLoaded   int
+		WantStatuses []string
+		WantSource   string
+		Existing     []string
+		WantCached   int
+	}{
+		{
+			Name:         "Array",
+			URL:          "/load/mock",
+			Body:         `[` + fmt.Sprintf(good, 1, 1) + `,` + fmt.Sprintf(good, 2, 2) + `]`,
+			WantStatus:   http.StatusCreated,
+			WantLoaded:   2,
+			WantStatuses: []string{resultCreated, resultCreated},
+			WantSource:   SourceAPI,
+		},
+		{
+			Name:         "Array with invalid mocks",
+			URL:          "/load/mock",
+			Body:         `[` + fmt.Sprintf(good, 1, 1) + `,` + badVerb + `,` + badJSON + `]`,
+			WantStatus:   http.StatusMultiStatus,
+			WantLoaded:   1,
+			WantStatuses: []string{resultCreated, resultInvalid, resultInvalid},
+			WantSource:   SourceAPI,
+		},
+		{
+			Name:         "Transactional array with invalid mocks",
+			URL:          "/load/mock?transactional=true",
+			Body:         `[` + fmt.Sprintf(good, 1, 1) + `,` + badVerb + `]`,
+			WantStatus:   http.StatusBadRequest,
+			WantLoaded:   0,
+			WantStatuses: []string{resultSkipped, resultInvalid},
+		},
+		{
+			Name:         "Bundle",
+			URL:          "/load/mock",
+			Body:         `{"name": "orders", "mocks": [` + fmt.Sprintf(good, 1, 1) + `]}`,
+			WantStatus:   http.StatusCreated,
+			WantLoaded:   1,
+			WantStatuses: []string{resultCreated},
+			WantSource:   "bundle:orders",
+		},
+		{
+			Name:         "Array replacing a mock",
+			URL:          "/load/mock",
+			Body:         `[` + fmt.Sprintf(good, 1, 1) + `,` + fmt.Sprintf(good, 2, 2) + `]`,
+			Existing:     []string{fmt.Sprintf(good, 1, 1)},
+			WantStatus:   http.StatusCreated,
+			WantLoaded:   2,
+			WantStatuses: []string{resultReplaced, resultCreated},
+			WantSource:   SourceAPI,
+		},
+		{
+			Name:         "Bundle only replacing mocks",
+			URL:          "/load/mock",
+			Body:         `{"name": "orders", "mocks": [` + fmt.Sprintf(good, 1, 1) + `]}`,
+			Existing:     []string{fmt.Sprintf(good, 1, 1), fmt.Sprintf(good, 2, 2)},
+			WantStatus:   http.StatusOK,
+			WantLoaded:   1,
+			WantStatuses: []string{resultReplaced},
+			WantSource:   "bundle:orders",
+			WantCached:   2,
+		},
+		{
+			Name:         "Transactional bundle with invalid mocks",
+			URL:          "/load/mock",
+			Body:         `{"name": "orders", "transactional": true, "mocks": [` + fmt.Sprintf(good, 1, 1) + `,` + fmt.Sprintf(good, 2, 2) + `,` + badVerb + `]}`,
+			WantStatus:   http.StatusBadRequest,
+			WantLoaded:   0,
+			WantStatuses: []string{resultSkipped, resultSkipped, resultInvalid},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			MocksCache = NewRouter()
+			for _, existing := range tc.Existing {
+				if rr := doRequest(t, app.MockLoader, "POST", "/load/mock", []byte(existing)); rr.Code != http.StatusCreated {
+					t.Fatalf("could not load existing mock: %s", rr.Body.String())
+				}
+			}
+			if tc.WantCached == 0 {
+				tc.WantCached = tc.WantLoaded
+			}
+
+			rr := doRequest(t, app.MockLoader, "POST", tc.URL, []byte(tc.Body))
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+
+			var res MockBundleResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Loaded != tc.WantLoaded || MocksCache.Len() != tc.WantCached {
+				t.Errorf("wrong number of mocks loaded: got %v (%v cached) want %v (%v cached)", res.Loaded, MocksCache.Len(), tc.WantLoaded, tc.WantCached)
+			}
+
+			var statuses []string
+			for i, result := range res.Results {
+				statuses = append(statuses, result.Status)
+				if result.Status == resultInvalid && len(result.Errors) == 0 {
+					t.Errorf("result %d is invalid without errors", i)
+				}
+				if result.Status == resultCreated || result.Status == resultReplaced {
+					mock, ok := MocksCache.Get(result.ID)
+					if !ok {
+						t.Errorf("result %d was not cached with its id '%s'", i, result.ID)
+					}
+					if mock.Source != tc.WantSource {
+						t.Errorf("wrong source: got %v want %v", mock.Source, tc.WantSource)
+					}
+				}
+			}
+			if !reflect.DeepEqual(statuses, tc.WantStatuses) {
+				t.Errorf("wrong results: got %v want %v", statuses, tc.WantStatuses)
+			}
+		})
+	}
+}
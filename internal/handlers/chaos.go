@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChaosConfig is the server wide chaos setting, a Percentage of matched requests are
+// answered with an error chosen from the StatusCodes instead of the mock response. When
+// EndPoints are given only requests whose path, or the endpoint of the matched mock,
+// matches one of the glob patterns e.g. `/api/arsys/v1/entry/*` are affected. A Seed
+// reseeds the random source so the injected errors are reproducible
+type ChaosConfig struct {
+	Percentage  float64  `json:"percentage"`
+	StatusCodes []int    `json:"statusCodes,omitempty"`
+	EndPoints   []string `json:"endPoints,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// ChaosResponse is the response of the admin chaos endpoints
+type ChaosResponse struct {
+	Enabled bool         `json:"enabled"`
+	Chaos   *ChaosConfig `json:"chaos,omitempty"`
+}
+
+// defaultChaosStatusCodes are the errors injected when no status codes are configured
+var defaultChaosStatusCodes = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusTooManyRequests,
+}
+
+// ChaosSettings holds the chaos setting, which can be changed while the server runs
+type ChaosSettings struct {
+	mu     sync.RWMutex
+	config *ChaosConfig
+}
+
+// Chaos is the server wide chaos setting, it is disabled until configured
+var Chaos = NewChaosSettings()
+
+// NewChaosSettings returns disabled ChaosSettings
+func NewChaosSettings() *ChaosSettings {
+	return &ChaosSettings{}
+}
+
+// Set validates and enables the chaos config, reseeding the random source if it has a seed
+func (c *ChaosSettings) Set(config ChaosConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if len(config.StatusCodes) == 0 {
+		config.StatusCodes = defaultChaosStatusCodes
+	}
+	if config.Seed != nil {
+		Seed(*config.Seed)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = &config
+	return nil
+}
+
+// Get returns the chaos config, the boolean is false when chaos is disabled
+func (c *ChaosSettings) Get() (ChaosConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return ChaosConfig{}, false
+	}
+	return *c.config, true
+}
+
+// Disable turns chaos off
+func (c *ChaosSettings) Disable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = nil
+}
+
+// inject decides whether to inject an error for a request matched by the mock, returning
+// the status code to respond with
+func (c *ChaosSettings) inject(reqPath string, mock mocks.Mock) (int, bool) {
+	config, ok := c.Get()
+	if !ok || config.Percentage <= 0 || !config.inScope(reqPath, mock) {
+		return 0, false
+	}
+	if randFloat64()*100 >= config.Percentage {
+		return 0, false
+	}
+	return config.StatusCodes[randIntn(len(config.StatusCodes))], true
+}
+
+// inScope reports whether the request path or mock endpoint matches the endpoint patterns
+func (config ChaosConfig) inScope(reqPath string, mock mocks.Mock) bool {
+	if len(config.EndPoints) == 0 {
+		return true
+	}
+	endPoint, _, _ := strings.Cut(mock.EndPoint, "?")
+	for _, pattern := range config.EndPoints {
+		if ok, _ := path.Match(pattern, reqPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, endPoint); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the percentage, status codes and endpoint patterns
+func (config ChaosConfig) validate() error {
+	if config.Percentage < 0 || config.Percentage > 100 {
+		return fmt.Errorf("percentage should be between 0 and 100, got %g", config.Percentage)
+	}
+	for _, code := range config.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("status code %d is not a valid http status", code)
+		}
+	}
+	for _, pattern := range config.EndPoints {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("endpoint pattern '%s' is invalid (%v)", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ParseChaos builds a chaos config from command line flags, the status codes and endpoint
+// patterns are comma separated lists
+func ParseChaos(percentage float64, statusCodes, endPoints string) (ChaosConfig, error) {
+	config := ChaosConfig{Percentage: percentage}
+	for _, s := range splitList(statusCodes) {
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return config, fmt.Errorf("invalid status code '%s'", s)
+		}
+		config.StatusCodes = append(config.StatusCodes, code)
+	}
+	config.EndPoints = splitList(endPoints)
+	return config, config.validate()
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// writeChaos responds with an injected error
+func (a *App) writeChaos(w http.ResponseWriter, r *http.Request, statusCode int, mock mocks.Mock) {
+	a.Logger.Warn(fmt.Sprintf("chaos injected %d for '%s %s' matched by mock '%s'", statusCode, r.Method, r.URL, mock.ID))
+	if statusCode == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	a.writeError(w, statusCode, "Injected by chaos mode")
+}
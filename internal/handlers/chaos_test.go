@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"testing"
+)
+
+func TestChaos(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer Chaos.Disable()
+
+	for _, id := range []string{"orders", "customers"} {
+		MocksCache.Add(mocks.Mock{
+			ID:       "chaos-" + id,
+			EndPoint: "/chaos/" + id + "/{id}",
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{StatusCode: http.StatusOK, RawBody: id},
+		})
+	}
+
+	t.Run("Scoped by endpoint pattern", func(t *testing.T) {
+		if err := Chaos.Set(ChaosConfig{Percentage: 100, StatusCodes: []int{http.StatusBadGateway}, EndPoints: []string{"/chaos/orders/*"}}); err != nil {
+			t.Fatal(err)
+		}
+		if rr := doRequest(t, app.Handler, "GET", "/chaos/orders/1", nil); rr.Code != http.StatusBadGateway {
+			t.Errorf("wrong status code for endpoint in scope: got %v want %v", rr.Code, http.StatusBadGateway)
+		}
+		if rr := doRequest(t, app.Handler, "GET", "/chaos/customers/1", nil); rr.Code != http.StatusOK {
+			t.Errorf("wrong status code for endpoint out of scope: got %v want %v", rr.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("Scoped by mock endpoint", func(t *testing.T) {
+		if err := Chaos.Set(ChaosConfig{Percentage: 100, EndPoints: []string{"/chaos/customers/{id}"}}); err != nil {
+			t.Fatal(err)
+		}
+		rr := doRequest(t, app.Handler, "GET", "/chaos/customers/1", nil)
+		if !containsInt(defaultChaosStatusCodes, rr.Code) {
+			t.Errorf("wrong status code: got %v want one of %v", rr.Code, defaultChaosStatusCodes)
+		}
+	})
+
+	t.Run("Reproducible with a seed", func(t *testing.T) {
+		run := func() []int {
+			seed := int64(42)
+			if err := Chaos.Set(ChaosConfig{Percentage: 50, Seed: &seed}); err != nil {
+				t.Fatal(err)
+			}
+			var codes []int
+			for i := 0; i < 20; i++ {
+				codes = append(codes, doRequest(t, app.Handler, "GET", "/chaos/orders/1", nil).Code)
+			}
+			return codes
+		}
+		first, second := run(), run()
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("wanted the same responses with the same seed: got %v and %v", first, second)
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		Chaos.Disable()
+		if rr := doRequest(t, app.Handler, "GET", "/chaos/orders/1", nil); rr.Code != http.StatusOK {
+			t.Errorf("wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestAdminChaos(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer Chaos.Disable()
+
+	testCases := []struct {
+		Name        string
+		Method      string
+		Body        string
+		WantStatus  int
+		WantEnabled bool
+	}{
+		{Name: "Disabled by default", Method: "GET", WantStatus: http.StatusOK},
+		{Name: "Enable", Method: "PUT", Body: `{"percentage": 25, "endPoints": ["/api/*"]}`, WantStatus: http.StatusOK, WantEnabled: true},
+		{Name: "Show", Method: "GET", WantStatus: http.StatusOK, WantEnabled: true},
+		{Name: "Bad percentage", Method: "PUT", Body: `{"percentage": 125}`, WantStatus: http.StatusBadRequest},
+		{Name: "Bad status code", Method: "PUT", Body: `{"percentage": 10, "statusCodes": [1000]}`, WantStatus: http.StatusBadRequest},
+		{Name: "Disable", Method: "DELETE", WantStatus: http.StatusOK},
+		{Name: "Not allowed", Method: "POST", WantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.Admin, tc.Method, "/__admin/chaos", []byte(tc.Body))
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+			if tc.WantStatus != http.StatusOK {
+				return
+			}
+			var res ChaosResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Enabled != tc.WantEnabled {
+				t.Errorf("wrong enabled: got %v want %v", res.Enabled, tc.WantEnabled)
+			}
+		})
+	}
+}
+
+func TestParseChaos(t *testing.T) {
+	config, err := ParseChaos(10, "500, 503", "/api/*,/other/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.StatusCodes) != 2 || config.StatusCodes[1] != 503 || len(config.EndPoints) != 2 {
+		t.Errorf("wrong config: %+v", config)
+	}
+	if _, err := ParseChaos(10, "oops", ""); err == nil {
+		t.Error("wanted an error for a bad status code")
+	}
+	if _, err := ParseChaos(10, "", "/api/["); err == nil {
+		t.Error("wanted an error for a bad endpoint pattern")
+	}
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDelay parses a delay given on the command line, either a fixed duration such as
+// `250ms` or a uniform range such as `100ms-500ms`
+func ParseDelay(s string) (*mocks.Delay, error) {
+	if s == "" {
+		return nil, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	minDelay, err := time.ParseDuration(strings.TrimSpace(lo))
+	if err != nil {
+		return nil, fmt.Errorf("invalid delay '%s' (%v)", s, err)
+	}
+	if !isRange {
+		return &mocks.Delay{Fixed: mocks.Duration(minDelay)}, nil
+	}
+	maxDelay, err := time.ParseDuration(strings.TrimSpace(hi))
+	if err != nil {
+		return nil, fmt.Errorf("invalid delay '%s' (%v)", s, err)
+	}
+	if maxDelay < minDelay {
+		return nil, fmt.Errorf("invalid delay '%s', the maximum is less than the minimum", s)
+	}
+	return &mocks.Delay{Min: mocks.Duration(minDelay), Max: mocks.Duration(maxDelay)}, nil
+}
+
+// delayFor samples the duration to wait before responding, the fixed part of the delay
+// plus a variable part from the percentiles, the lognormal distribution or the uniform range
+func delayFor(delay *mocks.Delay) time.Duration {
+	if delay == nil {
+		return 0
+	}
+
+	d := time.Duration(delay.Fixed)
+	switch {
+	case len(delay.Percentiles) > 0:
+		d += percentileDelay(delay.Percentiles)
+	case delay.Median > 0:
+		sigma := delay.Sigma
+		if sigma <= 0 {
+			sigma = 0.5
+		}
+		d += time.Duration(float64(delay.Median) * math.Exp(sigma*randNormFloat64()))
+	case delay.Max > delay.Min:
+		d += time.Duration(delay.Min) + time.Duration(randFloat64()*float64(delay.Max-delay.Min))
+	default:
+		d += time.Duration(delay.Min)
+	}
+
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// percentilePoint is a duration at a percentile of a latency distribution
+type percentilePoint struct {
+	p float64
+	d time.Duration
+}
+
+// percentileDelay samples a duration from a latency distribution described by its
+// percentiles, interpolating linearly between them. Keys are given as `p50`, `50` or `99.9`,
+// below the lowest percentile the duration rises from zero, above the highest it is capped
+func percentileDelay(percentiles map[string]mocks.Duration) time.Duration {
+	points := make([]percentilePoint, 0, len(percentiles)+1)
+	for k, v := range percentiles {
+		p, err := strconv.ParseFloat(strings.TrimPrefix(strings.ToLower(k), "p"), 64)
+		if err != nil || p < 0 || p > 100 {
+			continue
+		}
+		points = append(points, percentilePoint{p: p, d: time.Duration(v)})
+	}
+	if len(points) == 0 {
+		return 0
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].p < points[j].p })
+	points = append([]percentilePoint{{p: 0}}, points...)
+
+	sample := randFloat64() * 100
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if sample > hi.p {
+			continue
+		}
+		if hi.p == lo.p {
+			return hi.d
+		}
+		frac := (sample - lo.p) / (hi.p - lo.p)
+		return lo.d + time.Duration(frac*float64(hi.d-lo.d))
+	}
+	return points[len(points)-1].d
+}
+
+// sleep waits for the duration, it returns false if the context is done first, as it is
+// when the client goes away
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDelay(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Flag    string
+		Want    *mocks.Delay
+		WantErr bool
+	}{
+		{Name: "Not set", Flag: "", Want: nil},
+		{Name: "Fixed", Flag: "250ms", Want: &mocks.Delay{Fixed: mocks.Duration(250 * time.Millisecond)}},
+		{
+			Name: "Range",
+			Flag: "100ms-1s",
+			Want: &mocks.Delay{Min: mocks.Duration(100 * time.Millisecond), Max: mocks.Duration(time.Second)},
+		},
+		{Name: "Bad duration", Flag: "soon", WantErr: true},
+		{Name: "Range reversed", Flag: "1s-100ms", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := ParseDelay(tc.Flag)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wanted error %v got %v", tc.WantErr, err)
+			}
+			if tc.WantErr {
+				return
+			}
+			if (got == nil) != (tc.Want == nil) || (got != nil && (got.Fixed != tc.Want.Fixed || got.Min != tc.Want.Min || got.Max != tc.Want.Max)) {
+				t.Errorf("wanted %+v got %+v", tc.Want, got)
+			}
+		})
+	}
+}
+
+func TestDelayFor(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Delay    string
+		Min, Max time.Duration
+	}{
+		{Name: "Fixed as string", Delay: `{"fixed": "250ms"}`, Min: 250 * time.Millisecond, Max: 250 * time.Millisecond},
+		{Name: "Fixed as milliseconds", Delay: `{"fixed": 50}`, Min: 50 * time.Millisecond, Max: 50 * time.Millisecond},
+		{Name: "Uniform", Delay: `{"min": "100ms", "max": "200ms"}`, Min: 100 * time.Millisecond, Max: 200 * time.Millisecond},
+		{Name: "Fixed plus uniform", Delay: `{"fixed": "1s", "min": "100ms", "max": "200ms"}`, Min: 1100 * time.Millisecond, Max: 1200 * time.Millisecond},
+		{Name: "Percentiles", Delay: `{"percentiles": {"p50": "100ms", "p99": "1s", "100": "2s"}}`, Min: 0, Max: 2 * time.Second},
+		{Name: "Lognormal", Delay: `{"median": "100ms", "sigma": 0.25}`, Min: time.Millisecond, Max: 10 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var delay mocks.Delay
+			if err := json.Unmarshal([]byte(tc.Delay), &delay); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 100; i++ {
+				if got := delayFor(&delay); got < tc.Min || got > tc.Max {
+					t.Fatalf("wanted delay in [%s, %s] got %s", tc.Min, tc.Max, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPercentileDelayMedian(t *testing.T) {
+	percentiles := map[string]mocks.Duration{
+		"p50": mocks.Duration(100 * time.Millisecond),
+		"p90": mocks.Duration(time.Second),
+	}
+
+	below := 0
+	for i := 0; i < 1000; i++ {
+		if percentileDelay(percentiles) <= 100*time.Millisecond {
+			below++
+		}
+	}
+	if below < 400 || below > 600 {
+		t.Errorf("wanted around half of samples at or below the median, got %d of 1000", below)
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if sleep(ctx, time.Minute) {
+		t.Error("wanted sleep to report the context was done")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wanted sleep to return on cancellation, took %s", elapsed)
+	}
+}
+
+func TestDelayCancelledReleasesClaim(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+	defer func(state *StateStore) { State = state }(State)
+	State = NewStateStore()
+
+	MocksCache.Add(mocks.Mock{
+		ID:       "slow-approval",
+		Scenario: "slow-approval",
+		NewState: "Submitted",
+		EndPoint: "/slow/approval",
+		Request:  mocks.Request{Verb: "POST"},
+		Responses: []mocks.Response{
+			{StatusCode: http.StatusAccepted, Delay: &mocks.Delay{Fixed: mocks.Duration(200 * time.Millisecond)}},
+			{StatusCode: http.StatusOK},
+		},
+	})
+
+	// the client gives up during the delay of the first response
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("POST", "/slow/approval", nil).WithContext(ctx)
+	app.Handler(httptest.NewRecorder(), req)
+
+	testCases := []struct {
+		Name string
+		Got  interface{}
+		Want interface{}
+	}{
+		{Name: "Call not counted", Got: State.Calls()["slow-approval"], Want: 0},
+		{Name: "Scenario not moved", Got: State.ScenarioState("slow-approval"), Want: ScenarioStarted},
+		{Name: "First response sent to the next request", Got: doRequest(t, app.Handler, "POST", "/slow/approval", nil).Code, Want: http.StatusAccepted},
+		{Name: "Then the second", Got: doRequest(t, app.Handler, "POST", "/slow/approval", nil).Code, Want: http.StatusOK},
+		{Name: "Scenario moved once sent", Got: State.ScenarioState("slow-approval"), Want: "Submitted"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.Got, tc.Want) {
+				t.Errorf("wrong state after cancelled request: got %v want %v", tc.Got, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// faultTypes are the fault types which can be simulated
+var faultTypes = []string{
+	mocks.FaultConnectionReset,
+	mocks.FaultEmptyReply,
+	mocks.FaultMalformedBody,
+	mocks.FaultTrickle,
+	mocks.FaultStall,
+}
+
+// ParseFault parses a fault given on the command line, the fault type optionally followed
+// by the percentage of responses it applies to e.g. `connection_reset:10`
+func ParseFault(s string) (*mocks.Fault, error) {
+	if s == "" {
+		return nil, nil
+	}
+	faultType, probability, hasProbability := strings.Cut(s, ":")
+	fault := &mocks.Fault{Type: faultType}
+	if !containsString(faultTypes, fault.Type) {
+		return nil, fmt.Errorf("invalid fault '%s', the type should be one of %s", s, strings.Join(faultTypes, ", "))
+	}
+	if hasProbability {
+		if _, err := fmt.Sscanf(probability, "%g", &fault.Probability); err != nil || fault.Probability <= 0 || fault.Probability > 100 {
+			return nil, fmt.Errorf("invalid fault '%s', the probability should be a percentage", s)
+		}
+	}
+	return fault, nil
+}
+
+// injectFault reports whether the fault should be simulated for this response
+func injectFault(fault *mocks.Fault) bool {
+	if fault == nil || fault.Type == "" {
+		return false
+	}
+	if fault.Probability <= 0 || fault.Probability >= 100 {
+		return true
+	}
+	return randFloat64()*100 < fault.Probability
+}
+
+// writeFault simulates the fault in place of writing the mock response
+func (a *App) writeFault(w http.ResponseWriter, r *http.Request, fault *mocks.Fault, response mocks.Response, data templateData) {
+	a.Logger.Warn(fmt.Sprintf("simulating '%s' fault for '%s'", fault.Type, r.URL))
+
+	switch fault.Type {
+	case mocks.FaultConnectionReset:
+		a.closeConnection(w, true)
+
+	case mocks.FaultEmptyReply:
+		a.closeConnection(w, false)
+
+	case mocks.FaultMalformedBody:
+		a.setHeaders(w, response, data)
+		w.WriteHeader(response.StatusCode)
+		garbage := make([]byte, 64)
+		for i := range garbage {
+			garbage[i] = byte(randIntn(256))
+		}
+		_, _ = w.Write(garbage)
+
+	case mocks.FaultTrickle:
+		tw := &trickleWriter{
+			ResponseWriter: w,
+			request:        r,
+			chunkSize:      fault.ChunkSize,
+			chunkDelay:     time.Duration(fault.ChunkDelay),
+		}
+		if tw.chunkSize <= 0 {
+			tw.chunkSize = 1
+		}
+		if tw.chunkDelay <= 0 {
+			tw.chunkDelay = 100 * time.Millisecond
+		}
+		a.writeResponse(tw, response, data)
+
+	case mocks.FaultStall:
+		a.setHeaders(w, response, data)
+		w.WriteHeader(response.StatusCode)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		<-r.Context().Done()
+
+	default:
+		a.Logger.Warn(fmt.Sprintf("unknown fault type '%s', responding normally", fault.Type))
+		a.writeResponse(w, response, data)
+	}
+}
+
+// closeConnection takes over the connection and closes it without writing a response,
+// a reset discards unsent data so the client sees a connection reset rather than EOF.
+// Where the connection cannot be taken over the response is aborted instead
+func (a *App) closeConnection(w http.ResponseWriter, reset bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		a.Logger.Error("could not take over connection", err)
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && reset {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// trickleWriter writes the response body in chunks, flushing each and pausing between
+// them, it stops writing if the client goes away
+type trickleWriter struct {
+	http.ResponseWriter
+	request    *http.Request
+	chunkSize  int
+	chunkDelay time.Duration
+}
+
+// Write writes the body a chunk at a time
+func (tw *trickleWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		end := written + tw.chunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		n, err := tw.ResponseWriter.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		if written < len(b) && !sleep(tw.request.Context(), tw.chunkDelay) {
+			return written, tw.request.Context().Err()
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseFault(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		Flag            string
+		WantType        string
+		WantProbability float64
+		WantErr         bool
+	}{
+		{Name: "Not set", Flag: ""},
+		{Name: "Type only", Flag: "empty_reply", WantType: mocks.FaultEmptyReply},
+		{Name: "With probability", Flag: "stall:12.5", WantType: mocks.FaultStall, WantProbability: 12.5},
+		{Name: "Unknown type", Flag: "explode", WantErr: true},
+		{Name: "Bad probability", Flag: "stall:lots", WantErr: true},
+		{Name: "Probability out of range", Flag: "stall:150", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := ParseFault(tc.Flag)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wanted error %v got %v", tc.WantErr, err)
+			}
+			if tc.WantErr || tc.WantType == "" {
+				if got != nil {
+					t.Errorf("wanted no fault got %+v", got)
+				}
+				return
+			}
+			if got.Type != tc.WantType || got.Probability != tc.WantProbability {
+				t.Errorf("wanted %s:%g got %+v", tc.WantType, tc.WantProbability, got)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	server := httptest.NewServer(http.HandlerFunc(app.Handler))
+	defer server.Close()
+
+	addFault := func(id string, fault mocks.Fault) {
+		MocksCache.Add(mocks.Mock{
+			ID:       id,
+			EndPoint: "/faults/" + id,
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{
+				StatusCode: http.StatusOK,
+				Headers:    mocks.Properties{"Content-Type": "text/plain"},
+				RawBody:    "hello",
+				Fault:      &fault,
+			},
+		})
+	}
+	addFault(mocks.FaultConnectionReset, mocks.Fault{Type: mocks.FaultConnectionReset})
+	addFault(mocks.FaultEmptyReply, mocks.Fault{Type: mocks.FaultEmptyReply})
+	addFault(mocks.FaultMalformedBody, mocks.Fault{Type: mocks.FaultMalformedBody})
+	addFault(mocks.FaultTrickle, mocks.Fault{Type: mocks.FaultTrickle, ChunkSize: 2, ChunkDelay: mocks.Duration(20 * time.Millisecond)})
+	addFault(mocks.FaultStall, mocks.Fault{Type: mocks.FaultStall})
+
+	get := func(id string) (*http.Response, []byte, error) {
+		client := &http.Client{Timeout: 500 * time.Millisecond}
+		res, err := client.Get(server.URL + "/faults/" + id)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return res, body, err
+	}
+
+	t.Run("Connection reset", func(t *testing.T) {
+		if _, _, err := get(mocks.FaultConnectionReset); err == nil {
+			t.Error("wanted a connection error")
+		}
+	})
+
+	t.Run("Empty reply", func(t *testing.T) {
+		if _, _, err := get(mocks.FaultEmptyReply); err == nil {
+			t.Error("wanted a connection error")
+		}
+	})
+
+	t.Run("Malformed body", func(t *testing.T) {
+		res, body, err := get(mocks.FaultMalformedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK || string(body) == "hello" || len(body) == 0 {
+			t.Errorf("wanted status 200 with garbage body got %d '%s'", res.StatusCode, body)
+		}
+	})
+
+	t.Run("Trickle", func(t *testing.T) {
+		start := time.Now()
+		_, body, err := get(mocks.FaultTrickle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello" {
+			t.Errorf("wanted body 'hello' got '%s'", body)
+		}
+		// three chunks, with a pause between each
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("wanted the body to be trickled, took %s", elapsed)
+		}
+	})
+
+	t.Run("Stall", func(t *testing.T) {
+		if _, _, err := get(mocks.FaultStall); err == nil {
+			t.Error("wanted a timeout")
+		}
+	})
+}
+
+func TestInjectFaultProbability(t *testing.T) {
+	fault := &mocks.Fault{Type: mocks.FaultEmptyReply, Probability: 25}
+
+	injected := 0
+	for i := 0; i < 1000; i++ {
+		if injectFault(fault) {
+			injected++
+		}
+	}
+	if injected < 150 || injected > 350 {
+		t.Errorf("wanted around a quarter of faults injected, got %d of 1000", injected)
+	}
+	if injectFault(nil) {
+		t.Error("wanted no fault injected without a fault")
+	}
+}
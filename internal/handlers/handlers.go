@@ -1,59 +1,121 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spoonboy-io/ghost/internal/mocks"
 	"github.com/spoonboy-io/koan"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 // MockLoaderResponse is used to provide response data when requests are made to
-// the server to load mocks to the cache
+// the server to load mocks to the cache, the ID assigned to the loaded mock is included
 type MockLoaderResponse struct {
 	StatusCode int    `json:"statusCode"`
 	Status     string `json:"status"`
+	ID         string `json:"id,omitempty"`
 }
 
 // MockErrorResponse is used to respond when request cannot be matched against aa cached mock
 // or its header and body do not match the data in the cached mock. It is not used on succcess,
-// on success the mocks status response headers and response body are the response
+// on success the mocks status response headers and response body are the response.
+// Errors lists the problems with an invalid mock. NearMisses are the cached mocks closest to
+// matching an unmatched request, ranked, with how the request differed from each
 type MockErrorResponse struct {
-	StatusCode int    `json:"statusCode"`
-	Status     string `json:"status"`
-	Detail     string `json:"detail"`
+	StatusCode int                `json:"statusCode"`
+	Status     string             `json:"status"`
+	Detail     string             `json:"detail"`
+	Errors     []mocks.FieldError `json:"errors,omitempty"`
+	NearMisses []NearMiss         `json:"nearMisses,omitempty"`
 }
 
+// Mock sources, SourceAPI is the source of mocks loaded through the api and SourcePackage
+// begins the source of packaged mocks, it is followed by the package name
+const (
+	SourceAPI     = "api"
+	SourcePackage = "package:"
+)
+
+// App holds the dependencies and server wide settings of the handlers, DefaultDelay and
+// DefaultFault are applied to mock responses which do not specify a delay or fault of their own.
+// Requests which no mock matches are forwarded to the upstream by Proxy, if set, and the
+// Recorder, if set, captures the proxied requests and responses as mocks. Snapshots of the
+// runtime state are saved to the StateFile, if set
 type App struct {
-	Logger *koan.Logger
+	Logger       *koan.Logger
+	DefaultDelay *mocks.Delay
+	DefaultFault *mocks.Fault
+	Proxy        *Proxy
+	Recorder     *Recorder
+	StateFile    *StateFile
 }
 
-// MocksCache is a map cache of mocks, store on key of `uri-method`
-var MocksCache = make(map[string]mocks.Mock)
+// MocksCache is the cache of mocks, mocks are matched on endpoint template and method
+var MocksCache = NewRouter()
 
 // Handler is the handler for all requests it parses the request to match
-// against cached mocks (using endpoint and request method), if a match is found the incoming
-// request header and request body is checked agains the data specified in the mock, if the a match
-// the mock response is emitted to the client, otherwise errors are returned which identify how the request
-// was not a match or the data supplied was unacceptable
+// against cached mocks (using endpoint template and request method), each matching mock is a candidate
+// and in priority order the incoming request header and request body is checked against the data specified
+// in the candidate, the first candidate which is a match has its mock response emitted to the client, otherwise
+// errors are returned which identify how the request was not a match or the data supplied was unacceptable.
+// Unmatched requests are forwarded to the upstream instead when the App has a Proxy.
+// Every request is kept in the journal along with the mock matched and the response sent
 func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
-	var mock mocks.Mock
-	var ok bool
-
 	msg := fmt.Sprintf("request '%s'", r.URL)
 	a.Logger.Info(msg)
 
-	// strip end point, and verb
-	key := fmt.Sprintf("%s-%s", r.URL, r.Method)
-	if mock, ok = MocksCache[key]; !ok {
+	// the request body is read up front so it can be kept in the journal
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		a.Logger.Error("problem reading request body", err)
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	rec := newResponseRecorder(w)
+	entry := newJournalEntry(r, body)
+	defer func() {
+		entry.Response = rec.journalResponse()
+		Journal.Record(entry)
+	}()
+
+	entry.MockID, entry.Proxied = a.respond(rec, r)
+}
+
+// respond matches the request against the cached mocks and writes the response, it
+// returns the ID of the mock matched, if any, and whether the request was proxied
+func (a *App) respond(w http.ResponseWriter, r *http.Request) (mockID string, proxied bool) {
+	// request body, read once as it is checked against each candidate
+	bytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		a.Logger.Error("problem reading request body", err)
+	}
+	defer r.Body.Close()
+
+	reqBody, err := parseRequestBody(r.Header.Get("Content-Type"), bytes)
+	if err != nil {
+		a.Logger.Error("problem marshaling request body", err)
+	}
+
+	// match end point template, and verb
+	candidates := MocksCache.Match(r.Method, r.URL)
+	if len(candidates) == 0 && a.Proxy != nil {
+		a.proxy(w, r, a.Proxy, bytes)
+		return "", true
+	}
+	if len(candidates) == 0 {
 		res := MockErrorResponse{}
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		res.StatusCode = http.StatusBadRequest
 		res.Status = "Bad Request"
 		res.Detail = fmt.Sprintf("No mock for found for Url:%s and Method: %s", r.URL, r.Method)
+		res.NearMisses = nearMisses(r, bytes, reqBody, nearMissLimit)
 		out, err := json.Marshal(res)
 		if err != nil {
 			a.Logger.Error("problem marshaling response", err)
@@ -62,28 +124,59 @@ func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// we have a mock we can respond with
-	// check request meets expectations
-	// request headers
-	allHeaders := true
+	// we have candidate mocks we can respond with, in priority order
+	// the first whose request expectations are met is the match
+	var response mocks.Response
+	var release func()
+	var matchedMock mocks.Mock
+	var pathParams map[string]string
+	var failures []string
+	matched := false
 
-	for mk, mv := range mock.Request.Headers {
-		hv := r.Header.Get(mk)
-		if hv == "" {
-			allHeaders = false
+	for _, c := range candidates {
+		detail := checkRequest(c, r, bytes, reqBody)
+		if detail == "" {
+			if statusCode, ok := Chaos.inject(r.URL.Path, c.Mock); ok {
+				mockID = c.Mock.ID
+				a.writeChaos(w, r, statusCode, c.Mock)
+				return
+			}
+		}
+		if detail == "" {
+			var err error
+			response, release, err = State.Claim(c.Mock)
+			switch err {
+			case errSequenceExhausted:
+				detail = "Response sequence is exhausted"
+			case errScenarioChanged:
+				detail = fmt.Sprintf("Scenario '%s' changed state during the request", c.Mock.Scenario)
+			}
 		}
-		if hv != mv {
-			allHeaders = false
+		if detail == "" {
+			pathParams = c.PathParams
+			matchedMock = c.Mock
+			mockID = c.Mock.ID
+			matched = true
+			break
 		}
+		if len(candidates) > 1 {
+			detail = fmt.Sprintf("Mock '%s': %s", c.Mock.ID, detail)
+		}
+		failures = append(failures, detail)
 	}
 
-	if !allHeaders {
+	if !matched && a.Proxy != nil {
+		a.proxy(w, r, a.Proxy, bytes)
+		return "", true
+	}
+	if !matched {
 		res := MockErrorResponse{}
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusNotAcceptable)
 		res.StatusCode = http.StatusNotAcceptable
 		res.Status = "Not Acceptable"
-		res.Detail = fmt.Sprintf("Request Headers do not meet expectations. Wanted: %vGot: %v", mock.Request.Headers, r.Header)
+		res.Detail = strings.Join(failures, "; ")
+		res.NearMisses = nearMisses(r, bytes, reqBody, nearMissLimit)
 		out, err := json.Marshal(res)
 		if err != nil {
 			a.Logger.Error("problem marshaling response", err)
@@ -92,97 +185,111 @@ func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// request body
-	allRequestBody := true
-	reqBody := mocks.Properties{}
+	// simulate latency, giving up if the client goes away while we wait, the response was
+	// never sent so its place in the sequence and the scenario transition are given back
+	delay := response.Delay
+	if delay == nil {
+		delay = a.DefaultDelay
+	}
+	if d := delayFor(delay); !sleep(r.Context(), d) {
+		a.Logger.Warn(fmt.Sprintf("client went away during %s delay for '%s'", d, r.URL))
+		release()
+		return
+	}
 
-	bytes, err := ioutil.ReadAll(r.Body)
+	// the mock may forward the request to an upstream rather than respond itself
+	if matchedMock.ProxyTo != "" {
+		p, err := NewProxy(matchedMock.ProxyTo, matchedMock.ProxyHeaders)
+		if err != nil {
+			a.Logger.Error("could not proxy request", err)
+			a.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		a.proxy(w, r, p, bytes)
+		return mockID, true
+	}
+
+	// if here we are good, render any templated values and we'll output the mock response
+	data := newTemplateData(r, pathParams, reqBody)
+
+	// unless we are simulating a failure
+	fault := response.Fault
+	if fault == nil {
+		fault = a.DefaultFault
+	}
+	if injectFault(fault) {
+		a.writeFault(w, r, fault, response, data)
+		return
+	}
+
+	a.writeResponse(w, response, data)
+	return
+}
+
+// setHeaders renders the response headers and sets them on the writer, the rendered
+// headers are returned
+func (a *App) setHeaders(w http.ResponseWriter, response mocks.Response, data templateData) mocks.Properties {
+	resHeaders, err := renderProperties(response.Headers, data)
 	if err != nil {
-		a.Logger.Error("problem reading request body", err)
+		a.Logger.Error("could not render response headers", err)
+		resHeaders = response.Headers
 	}
-	defer r.Body.Close()
 
-	if len(bytes) > 0 {
-		if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
-			// make the map by parsing
-			pairs := strings.Split(string(bytes), "&")
-			for _, pair := range pairs {
-				kv := strings.Split(pair, "=")
-				reqBody[kv[0]] = kv[1]
-			}
-		} else {
-			// json to unmarshal
-			err = json.Unmarshal(bytes, &reqBody)
-			if err != nil {
-				a.Logger.Error("problem marshaling request body", err)
-			}
-		}
+	for k, v := range resHeaders {
+		w.Header().Add(k, v.(string))
 	}
+	return resHeaders
+}
 
-	if len(reqBody) == 0 && len(mock.Request.Body) != 0 {
-		allRequestBody = false
-	} else {
-		for mk, mv := range mock.Request.Body {
-			var bv string
-			var ok bool
-			// type assertion
-			switch reqBody[mk].(type) {
-			case string:
-				//fmt.Println("body", mk)
-				if bv, ok = reqBody[mk].(string); !ok {
-					fmt.Println("missing", mk)
-					allRequestBody = false
-				} else {
-					if mv != bv {
-						allRequestBody = false
-					}
-				}
-			case nil:
-				fmt.Println("body", mk)
-				if _, ok := reqBody[mk]; !ok {
-					allRequestBody = false
-				}
-			}
-		}
+// writeResponse renders and writes a mock response, a raw body is written byte-for-byte
+// otherwise the structured body is marshaled to json. The client receives a 500 in place
+// of the response if its raw body cannot be loaded
+func (a *App) writeResponse(w http.ResponseWriter, response mocks.Response, data templateData) {
+	// handle raw bodies, loaded before anything is written so a failure can be reported
+	raw, isRaw, err := rawBody(response, data)
+	if err != nil {
+		a.Logger.Error("could not load raw response body", err)
+		a.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Could not load the raw body of the mock response (%v)", err))
+		return
 	}
 
-	if !allRequestBody {
-		res := MockErrorResponse{}
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusNotAcceptable)
-		res.StatusCode = http.StatusNotAcceptable
-		res.Status = "Not Acceptable"
-		res.Detail = fmt.Sprintf("Request Body does not meet expecations. Wanted: %v, Got: %v", mock.Request.Body, reqBody)
-		out, err := json.Marshal(res)
-		if err != nil {
-			a.Logger.Error("problem marshaling response", err)
+	resHeaders := a.setHeaders(w, response, data)
+	if isRaw {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", detectContentType(response.BodyFile, raw))
 		}
-		_, _ = w.Write(out)
+		w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+		w.WriteHeader(response.StatusCode)
+
+		if response.RawBody != "" {
+			a.Logger.Info(fmt.Sprintf("response '%s'", raw))
+		} else {
+			a.Logger.Info(fmt.Sprintf("response (%d bytes)", len(raw)))
+		}
+
+		_, _ = w.Write(raw)
 		return
 	}
 
-	// if here we are good and we'll output the mock response
-	w.WriteHeader(mock.Response.StatusCode)
-	for k, v := range mock.Response.Headers {
-		w.Header().Add(k, v.(string))
+	resBody, err := renderProperties(response.Body, data)
+	if err != nil {
+		a.Logger.Error("could not render response body", err)
+		resBody = response.Body
 	}
 
-	// handle text/plain
-	if ct, ok := mock.Response.Headers["Content-Type"]; ok {
+	// handle text/plain, a legacy form of raw body where the body is a map
+	// key whose value is nil
+	if ct, ok := resHeaders["Content-Type"]; ok {
 		if ct == "text/plain" {
 			w.Header().Set("content-type", "text/plain")
-			// convert to json
+			w.WriteHeader(response.StatusCode)
 			out := ""
-			for k, v := range mock.Response.Body {
+			for k, v := range resBody {
 				if v == nil {
 					out += fmt.Sprintf("%s", k)
 				}
 			}
 
-			if err != nil {
-				a.Logger.Error("could not marshal response body", err)
-			}
-
 			msg := fmt.Sprintf("response '%s'", out)
 			a.Logger.Info(msg)
 
@@ -191,68 +298,96 @@ func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	body, err := json.Marshal(mock.Response.Body)
+	w.WriteHeader(response.StatusCode)
+
+	body, err := json.Marshal(resBody)
 	if err != nil {
 		a.Logger.Error("could not marshal response body", err)
 	}
 
-	msg = fmt.Sprintf("response '%s'", string(body))
+	msg := fmt.Sprintf("response '%s'", string(body))
 	a.Logger.Info(msg)
 
 	_, _ = w.Write(body)
 }
 
 // MockLoader allows mocks signatures to be loaded to the server cache on the fly
-// via a POST request to ths listening endpoint
+// via a POST request to ths listening endpoint, the body is a single mock, an array
+// of mocks, or a bundle of mocks (see MockBundle). A mock is validated before it is
+// cached, an invalid mock is rejected with the errors found in each field
 func (a *App) MockLoader(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-	res := MockLoaderResponse{}
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		res.StatusCode = http.StatusMethodNotAllowed
-		res.Status = "Method not allowed"
-	} else {
-		// parse the mock config from request body
-		onErr := false
-		if r.Body == nil {
-			onErr = true
-		} else {
-			body, err := ioutil.ReadAll(r.Body)
-			defer r.Body.Close()
+		a.writeJSON(w, http.StatusMethodNotAllowed, MockLoaderResponse{
+			StatusCode: http.StatusMethodNotAllowed,
+			Status:     "Method not allowed",
+		})
+		return
+	}
 
-			if err != nil {
-				onErr = true
-				a.Logger.Error("problem reading request body", err)
-			}
+	// parse the mock config from request body
+	var body []byte
+	var err error
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+	}
+	if err != nil {
+		a.Logger.Error("problem reading request body", err)
+		a.writeError(w, http.StatusBadRequest, "Could not read request body")
+		return
+	}
 
-			mock := mocks.Mock{}
-			if err := json.Unmarshal(body, &mock); err != nil {
-				onErr = true
-				a.Logger.Error("problem unmarshaling request body", err)
-			}
+	// several mocks may be loaded at once, as an array or a bundle
+	if isBulk(body) {
+		a.loadBulk(w, r, body)
+		return
+	}
 
-			// add/update the mocks list
-			// key is endpoint, verb
-			mockKey := fmt.Sprintf("%s-%s", mock.EndPoint, mock.Request.Verb)
-			MocksCache[mockKey] = mock
-			a.Logger.Info(fmt.Sprintf("added new mock '%s'\n", mockKey))
+	mock := mocks.Mock{}
+	if err := json.Unmarshal(body, &mock); err != nil {
+		a.Logger.Error("problem unmarshaling request body", err)
+		res := MockErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     http.StatusText(http.StatusBadRequest),
+			Detail:     "Request body should be a json mock",
+			Errors:     []mocks.FieldError{{Message: err.Error()}},
 		}
-
-		if onErr {
-			// bad request
-			w.WriteHeader(http.StatusBadRequest)
-			res.StatusCode = http.StatusBadRequest
-			res.Status = "Bad request"
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			res.Errors[0] = mocks.FieldError{Field: typeErr.Field, Message: fmt.Sprintf("should be %s, got %s", typeErr.Type, typeErr.Value)}
 		}
+		a.writeJSON(w, http.StatusBadRequest, res)
+		return
+	}
 
-		w.WriteHeader(http.StatusCreated)
-		res.StatusCode = http.StatusCreated
-		res.Status = "Created"
+	if errs := mock.ValidateRemote(); len(errs) > 0 {
+		a.Logger.Warn(fmt.Sprintf("rejected invalid mock '%s', %d errors", mockKey(mock), len(errs)))
+		a.writeJSON(w, http.StatusBadRequest, MockErrorResponse{
+			StatusCode: http.StatusBadRequest,
+			Status:     http.StatusText(http.StatusBadRequest),
+			Detail:     "Mock is invalid",
+			Errors:     errs,
+		})
+		return
 	}
 
-	out, err := json.Marshal(res)
-	if err != nil {
-		a.Logger.Error("problem marshaling response", err)
+	// add/update the mocks list
+	// a mock with the same id, or without an id expecting the same request, is replaced
+	if mock.Source == "" {
+		mock.Source = SourceAPI
 	}
-	_, _ = w.Write(out)
+	statusCode := http.StatusCreated
+	id, replaced := MocksCache.Put(mock)
+	if replaced {
+		statusCode = http.StatusOK
+		a.Logger.Info(fmt.Sprintf("replaced mock '%s' (%s)", mockKey(mock), id))
+	} else {
+		a.Logger.Info(fmt.Sprintf("added new mock '%s' (%s)", mockKey(mock), id))
+	}
+
+	a.writeJSON(w, statusCode, MockLoaderResponse{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		ID:         id,
+	})
 }
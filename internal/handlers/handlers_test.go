@@ -3,11 +3,11 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"github.com/spoonboy-io/ghost/internal/mocks"
 	"github.com/spoonboy-io/koan"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -137,6 +137,122 @@ func TestMockLoader(t *testing.T) {
 	}
 }
 
+func TestMockLoaderValidation(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+
+	testCases := []struct {
+		Name           string
+		Body           string
+		WantStatusCode int
+		WantFields     []string
+	}{
+		{
+			Name:           "Broken json",
+			Body:           `{"endPoint": "/broken", "request": {"verb": "GET"`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{""},
+		},
+		{
+			Name:           "Wrong type",
+			Body:           `{"endPoint": "/typed", "request": {"verb": "GET"}, "response": {"status": "200"}}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"response.status"},
+		},
+		{
+			Name:           "Empty mock",
+			Body:           `{}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"endPoint", "request.verb", "response.status"},
+		},
+		{
+			Name:           "Unknown verb, status out of range and header not a string",
+			Body:           `{"endPoint": "/bad", "request": {"verb": "FETCH"}, "response": {"status": 42, "headers": {"X-Count": 1}}}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"request.verb", "response.status", "response.headers.X-Count"},
+		},
+		{
+			Name:           "Invalid response in sequence",
+			Body:           `{"endPoint": "/seq", "request": {"verb": "GET"}, "responses": [{"status": 200}, {"status": 1000}]}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"responses[1].status"},
+		},
+		{
+			Name:           "Base64 body which does not decode",
+			Body:           `{"endPoint": "/binary", "request": {"verb": "GET"}, "response": {"status": 200, "base64Body": "not base64!"}}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"response.base64Body"},
+		},
+		{
+			Name:           "Files on the server not allowed from a client",
+			Body:           `{"endPoint": "/file", "request": {"verb": "GET", "schemaFile": "schema.json"}, "responses": [{"status": 200, "bodyFile": "/etc/hostname"}]}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"request.schemaFile", "responses[0].bodyFile"},
+		},
+		{
+			Name:           "Relative proxy target and header not a string",
+			Body:           `{"endPoint": "/proxied", "request": {"verb": "GET"}, "proxyTo": "/upstream", "proxyHeaders": {"add": {"X-Count": 1}}}`,
+			WantStatusCode: http.StatusBadRequest,
+			WantFields:     []string{"proxyTo", "proxyHeaders.add.X-Count"},
+		},
+		{
+			Name:           "Proxying mock without a response",
+			Body:           `{"endPoint": "/proxied", "request": {"verb": "GET"}, "proxyTo": "http://localhost:8080"}`,
+			WantStatusCode: http.StatusCreated,
+		},
+		{
+			Name:           "Created",
+			Body:           `{"id": "validated", "endPoint": "/ok", "request": {"verb": "get"}, "response": {"status": 200}}`,
+			WantStatusCode: http.StatusCreated,
+		},
+		{
+			Name:           "Replaced",
+			Body:           `{"id": "validated", "endPoint": "/ok", "request": {"verb": "GET"}, "response": {"status": 204}}`,
+			WantStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.MockLoader, "POST", "/load/mock", []byte(tc.Body))
+			if rr.Code != tc.WantStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatusCode, rr.Body.String())
+			}
+
+			if tc.WantFields == nil {
+				var res MockLoaderResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.StatusCode != tc.WantStatusCode || res.Status != http.StatusText(tc.WantStatusCode) || res.ID == "" {
+					t.Errorf("wrong response: %+v", res)
+				}
+				return
+			}
+
+			var res MockErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			var fields []string
+			for _, e := range res.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tc.WantFields) {
+				t.Errorf("wrong field errors: got %v want %v (%s)", fields, tc.WantFields, rr.Body.String())
+			}
+		})
+	}
+
+	// only the valid mocks are cached
+	if got := MocksCache.Len(); got != 2 {
+		t.Errorf("wrong number of mocks cached: got %v want %v", got, 2)
+	}
+}
+
 func seedMockData() {
 	// seed some dummy data for tests
 	dummies := []mocks.Mock{
@@ -161,12 +277,58 @@ func seedMockData() {
 				},
 			},
 		},
+		{
+			EndPoint: "good/items/{id}",
+			Request: mocks.Request{
+				Verb: "GET",
+				PathParams: mocks.Properties{
+					"id": "7",
+				},
+			},
+			Response: mocks.Response{
+				StatusCode: 200,
+				Headers: mocks.Properties{
+					"content-type": "application/json",
+				},
+				Body: mocks.Properties{
+					"id": "{{ .Path.id }}",
+				},
+			},
+		},
 	}
 
+	// variants of the same endpoint and verb, the catch-all is tried last
+	variants := []mocks.Mock{
+		{
+			ID:       "login-good",
+			Priority: 1,
+			EndPoint: "good/login",
+			Request: mocks.Request{
+				Verb: "POST",
+				Body: mocks.Properties{
+					"password": "secret",
+				},
+			},
+			Response: mocks.Response{
+				StatusCode: 200,
+			},
+		},
+		{
+			ID:       "login-bad",
+			EndPoint: "good/login",
+			Request: mocks.Request{
+				Verb: "POST",
+			},
+			Response: mocks.Response{
+				StatusCode: 401,
+			},
+		},
+	}
+	dummies = append(dummies, variants...)
+
 	// load the dummies to mocks map
 	for _, mock := range dummies {
-		key := fmt.Sprintf("%s-%s", mock.EndPoint, mock.Request.Verb)
-		MocksCache[key] = mock
+		MocksCache.Add(mock)
 	}
 
 }
@@ -435,6 +597,68 @@ func TestHandler(t *testing.T) {
 				StatusCode: http.StatusNotAcceptable,
 			},
 		},
+		{
+			Name:   "Good, request uri matches endpoint template and path parameter",
+			Method: "GET",
+			Mock: mocks.Mock{
+				EndPoint: "good/items/7",
+				Request: mocks.Request{
+					Verb: "GET",
+				},
+			},
+			WantStatusCode: http.StatusOK,
+			WantStatus: MockLoaderResponse{
+				StatusCode: http.StatusOK,
+			},
+		},
+		{
+			Name:   "Bad, path parameter not match",
+			Method: "GET",
+			Mock: mocks.Mock{
+				EndPoint: "good/items/8",
+				Request: mocks.Request{
+					Verb: "GET",
+				},
+			},
+			WantStatusCode: http.StatusNotAcceptable,
+			WantStatus: MockLoaderResponse{
+				StatusCode: http.StatusNotAcceptable,
+			},
+		},
+		{
+			Name:   "Good, first variant in priority order is matched",
+			Method: "POST",
+			Mock: mocks.Mock{
+				EndPoint: "good/login",
+				Request: mocks.Request{
+					Verb: "POST",
+					Body: mocks.Properties{
+						"password": "secret",
+					},
+				},
+			},
+			WantStatusCode: http.StatusOK,
+			WantStatus: MockLoaderResponse{
+				StatusCode: http.StatusOK,
+			},
+		},
+		{
+			Name:   "Good, catch-all variant is matched when others are not",
+			Method: "POST",
+			Mock: mocks.Mock{
+				EndPoint: "good/login",
+				Request: mocks.Request{
+					Verb: "POST",
+					Body: mocks.Properties{
+						"password": "wrong",
+					},
+				},
+			},
+			WantStatusCode: http.StatusUnauthorized,
+			WantStatus: MockLoaderResponse{
+				StatusCode: http.StatusUnauthorized,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
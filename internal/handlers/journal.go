@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalBodyLimit is the most of a request or response body kept in the journal
+const journalBodyLimit = 64 << 10
+
+// JournalEntry records a request received by the mock server, the ID of the mock which
+// matched it (empty when no mock matched), whether it was Proxied to an upstream and the
+// response sent. BodyTruncated is set when the body was cut to the journal body limit
+type JournalEntry struct {
+	ID            string          `json:"id"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Method        string          `json:"method"`
+	URL           string          `json:"url"`
+	Path          string          `json:"path"`
+	Headers       http.Header     `json:"headers"`
+	Body          string          `json:"body,omitempty"`
+	BodyTruncated bool            `json:"bodyTruncated,omitempty"`
+	MockID        string          `json:"mockId,omitempty"`
+	Proxied       bool            `json:"proxied,omitempty"`
+	Response      JournalResponse `json:"response"`
+}
+
+// JournalResponse records the response sent to a request, the StatusCode is 0 if the
+// connection was closed without a response
+type JournalResponse struct {
+	StatusCode int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// RequestsResponse is the response of the admin requests endpoints
+type RequestsResponse struct {
+	Requests []JournalEntry `json:"requests"`
+	Total    int            `json:"total"`
+}
+
+// RequestJournal keeps the most recent requests, it is bounded so once full the oldest
+// request is dropped for each new one
+type RequestJournal struct {
+	mu      sync.RWMutex
+	entries []JournalEntry
+	start   int
+	count   int
+}
+
+// Journal is the journal of requests received by the Handler
+var Journal = NewRequestJournal(1000)
+
+// NewRequestJournal returns an empty journal which keeps up to size requests
+func NewRequestJournal(size int) *RequestJournal {
+	if size < 1 {
+		size = 1
+	}
+	return &RequestJournal{entries: make([]JournalEntry, size)}
+}
+
+// Record adds a request to the journal
+func (j *RequestJournal) Record(entry JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.count < len(j.entries) {
+		j.entries[(j.start+j.count)%len(j.entries)] = entry
+		j.count++
+		return
+	}
+	j.entries[j.start] = entry
+	j.start = (j.start + 1) % len(j.entries)
+}
+
+// Entries returns the requests in the journal which pass the filter, oldest first
+func (j *RequestJournal) Entries(filter func(JournalEntry) bool) []JournalEntry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	list := []JournalEntry{}
+	for i := 0; i < j.count; i++ {
+		entry := j.entries[(j.start+i)%len(j.entries)]
+		if filter == nil || filter(entry) {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// Reset empties the journal
+func (j *RequestJournal) Reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = make([]JournalEntry, len(j.entries))
+	j.start, j.count = 0, 0
+}
+
+// newJournalEntry records the request and its body
+func newJournalEntry(r *http.Request, body []byte) JournalEntry {
+	return JournalEntry{
+		ID:            newID(),
+		Timestamp:     time.Now(),
+		Method:        r.Method,
+		URL:           r.URL.String(),
+		Path:          r.URL.Path,
+		Headers:       r.Header.Clone(),
+		Body:          truncateBody(body),
+		BodyTruncated: len(body) > journalBodyLimit,
+	}
+}
+
+// journalFilter builds a filter from the query of an admin request. Requests can be
+// filtered by `method`, `path` (a glob pattern), `mockId`, `matched` and `proxied` (true or
+// false) and `since` (an RFC 3339 timestamp)
+func journalFilter(query map[string][]string) (func(JournalEntry) bool, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	method, pathPattern, mockID := get("method"), get("path"), get("mockId")
+
+	boolParam := func(key string) (*bool, error) {
+		s := get(key)
+		if s == "" {
+			return nil, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s should be true or false, got '%s'", key, s)
+		}
+		return &b, nil
+	}
+	matched, err := boolParam("matched")
+	if err != nil {
+		return nil, err
+	}
+	proxied, err := boolParam("proxied")
+	if err != nil {
+		return nil, err
+	}
+
+	var since time.Time
+	if s := get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("since should be an RFC 3339 timestamp, got '%s'", s)
+		}
+		since = t
+	}
+
+	if pathPattern != "" {
+		if _, err := path.Match(pathPattern, ""); err != nil {
+			return nil, fmt.Errorf("path pattern '%s' is invalid (%v)", pathPattern, err)
+		}
+	}
+
+	return func(e JournalEntry) bool {
+		if method != "" && !strings.EqualFold(method, e.Method) {
+			return false
+		}
+		if pathPattern != "" {
+			if ok, _ := path.Match(pathPattern, e.Path); !ok {
+				return false
+			}
+		}
+		if mockID != "" && mockID != e.MockID {
+			return false
+		}
+		if matched != nil && *matched != (e.MockID != "") {
+			return false
+		}
+		if proxied != nil && *proxied != e.Proxied {
+			return false
+		}
+		if !since.IsZero() && e.Timestamp.Before(since) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// truncateBody converts a body to a string, cut to the journal body limit
+func truncateBody(body []byte) string {
+	if len(body) > journalBodyLimit {
+		return string(body[:journalBodyLimit])
+	}
+	return string(body)
+}
+
+// responseRecorder is a ResponseWriter which records the response written through it so it
+// can be kept in the journal, it supports flushing and hijacking as faults need them
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	headers    http.Header
+	body       []byte
+}
+
+// newResponseRecorder returns a recorder writing through to the ResponseWriter
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and headers
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+		rec.headers = rec.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the body, up to the journal body limit
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if room := journalBodyLimit - len(rec.body); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		rec.body = append(rec.body, b[:room]...)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying ResponseWriter, if it can
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, if it can
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// journalResponse returns the recorded response
+func (rec *responseRecorder) journalResponse() JournalResponse {
+	return JournalResponse{
+		StatusCode: rec.statusCode,
+		Headers:    rec.headers,
+		Body:       string(rec.body),
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequestJournal(t *testing.T) {
+	j := NewRequestJournal(3)
+	for i := 1; i <= 5; i++ {
+		j.Record(JournalEntry{ID: fmt.Sprint(i)})
+	}
+
+	var ids []string
+	for _, e := range j.Entries(nil) {
+		ids = append(ids, e.ID)
+	}
+	if want := []string{"3", "4", "5"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("wrong entries kept: got %v want %v", ids, want)
+	}
+
+	j.Reset()
+	if got := len(j.Entries(nil)); got != 0 {
+		t.Errorf("wrong number of entries after reset: got %v want %v", got, 0)
+	}
+}
+
+func TestAdminRequests(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(journal *RequestJournal) { Journal = journal }(Journal)
+	Journal = NewRequestJournal(100)
+
+	MocksCache.Add(mocks.Mock{
+		ID:       "journal-item",
+		EndPoint: "/journal/items/{id}",
+		Request:  mocks.Request{Verb: "POST"},
+		Response: mocks.Response{
+			StatusCode: http.StatusCreated,
+			Headers:    mocks.Properties{"Content-Type": "application/json"},
+			RawBody:    `{"id": "{{ .Path.id }}"}`,
+			Template:   true,
+		},
+	})
+
+	doRequest(t, app.Handler, "POST", "/journal/items/1", []byte(`{"name": "one"}`))
+	doRequest(t, app.Handler, "POST", "/journal/items/2", []byte(`{"name": "two"}`))
+	doRequest(t, app.Handler, "GET", "/journal/missing", nil)
+
+	testCases := []struct {
+		Name       string
+		URL        string
+		WantStatus int
+		WantURLs   []string
+		WantTotal  int
+	}{
+		{Name: "All", URL: "/__admin/requests", WantStatus: http.StatusOK, WantURLs: []string{"/journal/items/1", "/journal/items/2", "/journal/missing"}, WantTotal: 3},
+		{Name: "By method", URL: "/__admin/requests?method=get", WantStatus: http.StatusOK, WantURLs: []string{"/journal/missing"}, WantTotal: 1},
+		{Name: "By path", URL: "/__admin/requests?path=/journal/items/*", WantStatus: http.StatusOK, WantURLs: []string{"/journal/items/1", "/journal/items/2"}, WantTotal: 2},
+		{Name: "By mock", URL: "/__admin/requests?mockId=journal-item", WantStatus: http.StatusOK, WantURLs: []string{"/journal/items/1", "/journal/items/2"}, WantTotal: 2},
+		{Name: "Unmatched", URL: "/__admin/requests?matched=false", WantStatus: http.StatusOK, WantURLs: []string{"/journal/missing"}, WantTotal: 1},
+		{Name: "Limit", URL: "/__admin/requests?limit=1", WantStatus: http.StatusOK, WantURLs: []string{"/journal/missing"}, WantTotal: 3},
+		{Name: "Since", URL: "/__admin/requests?since=2100-01-01T00:00:00Z", WantStatus: http.StatusOK, WantURLs: nil, WantTotal: 0},
+		{Name: "Bad filter", URL: "/__admin/requests?matched=maybe", WantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.Admin, "GET", tc.URL, nil)
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+			if tc.WantStatus != http.StatusOK {
+				return
+			}
+			var res RequestsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			var urls []string
+			for _, e := range res.Requests {
+				urls = append(urls, e.URL)
+			}
+			if !reflect.DeepEqual(urls, tc.WantURLs) || res.Total != tc.WantTotal {
+				t.Errorf("wrong requests: got %v (total %v) want %v (total %v)", urls, res.Total, tc.WantURLs, tc.WantTotal)
+			}
+		})
+	}
+
+	// the request and response are recorded
+	entries := Journal.Entries(nil)
+	first := entries[0]
+	if first.MockID != "journal-item" || first.Body != `{"name": "one"}` || first.Method != "POST" {
+		t.Errorf("wrong request recorded: %+v", first)
+	}
+	if first.Response.StatusCode != http.StatusCreated || first.Response.Body != `{"id": "1"}` ||
+		first.Response.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("wrong response recorded: %+v", first.Response)
+	}
+	if missing := entries[2]; missing.MockID != "" || missing.Response.StatusCode != http.StatusBadRequest {
+		t.Errorf("wrong unmatched request recorded: %+v", missing)
+	}
+
+	rr := doRequest(t, app.Admin, "DELETE", "/__admin/requests", nil)
+	if rr.Code != http.StatusOK || len(Journal.Entries(nil)) != 0 {
+		t.Errorf("journal not cleared: %v", rr.Body.String())
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// selectPath evaluates a path expression against a parsed json document and returns the
+// selected values. The expression is either an RFC 6901 JSON Pointer such as
+// `/values/Login ID`, or a JSONPath such as `$.values['Login ID']` supporting child names,
+// bracketed names, array indexes (negative from the end), wildcards and recursive descent
+func selectPath(doc interface{}, expr string) ([]interface{}, error) {
+	if expr == "" || strings.HasPrefix(expr, "/") {
+		v, ok, err := selectPointer(doc, expr)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return []interface{}{v}, nil
+	}
+	if strings.HasPrefix(expr, "$") {
+		return selectJSONPath(doc, expr)
+	}
+	return nil, fmt.Errorf("path '%s' should be a JSONPath starting '$' or a JSON Pointer starting '/'", expr)
+}
+
+// selectPointer evaluates a JSON Pointer, the boolean is false when nothing is found
+func selectPointer(doc interface{}, pointer string) (interface{}, bool, error) {
+	if pointer == "" {
+		return doc, true, nil
+	}
+
+	current := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := normalise(current).(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, false, nil
+			}
+			current = v
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false, nil
+			}
+			current = node[i]
+		default:
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
+
+// jsonPathStep is a single step of a parsed JSONPath
+type jsonPathStep struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// selectJSONPath evaluates a JSONPath expression
+func selectJSONPath(doc interface{}, expr string) ([]interface{}, error) {
+	steps, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{doc}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			if step.recursive {
+				for _, descendant := range descendants(node) {
+					next = append(next, applyStep(descendant, step)...)
+				}
+				continue
+			}
+			next = append(next, applyStep(node, step)...)
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// applyStep selects the children of a node for a step
+func applyStep(node interface{}, step jsonPathStep) []interface{} {
+	switch n := normalise(node).(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			var out []interface{}
+			for _, k := range sortedKeys(n) {
+				out = append(out, n[k])
+			}
+			return out
+		}
+		if v, ok := n[step.name]; ok && !step.isIndex {
+			return []interface{}{v}
+		}
+	case []interface{}:
+		if step.wildcard {
+			return n
+		}
+		if step.isIndex {
+			i := step.index
+			if i < 0 {
+				i += len(n)
+			}
+			if i >= 0 && i < len(n) {
+				return []interface{}{n[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// descendants returns the node and all nodes beneath it, for recursive descent
+func descendants(node interface{}) []interface{} {
+	out := []interface{}{node}
+	switch n := normalise(node).(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(n) {
+			out = append(out, descendants(n[k])...)
+		}
+	case []interface{}:
+		for _, item := range n {
+			out = append(out, descendants(item)...)
+		}
+	}
+	return out
+}
+
+// parseJSONPath parses a JSONPath expression to its steps
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	var steps []jsonPathStep
+	rest := expr[1:]
+
+	for rest != "" {
+		recursive := false
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("bad JSONPath '%s', empty name", expr)
+			}
+			rest = rest[end:]
+			steps = append(steps, jsonPathStep{name: name, wildcard: name == "*", recursive: recursive})
+			continue
+		}
+
+		if !strings.HasPrefix(rest, "[") {
+			return nil, fmt.Errorf("bad JSONPath '%s', unexpected '%s'", expr, rest)
+		}
+
+		step, n, err := parseBracket(rest)
+		if err != nil {
+			return nil, fmt.Errorf("bad JSONPath '%s', %v", expr, err)
+		}
+		step.recursive = recursive
+		steps = append(steps, step)
+		rest = rest[n:]
+	}
+	return steps, nil
+}
+
+// parseBracket parses a bracketed step, `['name']`, `["name"]`, `[0]` or `[*]`, returning
+// the step and the number of characters consumed
+func parseBracket(s string) (jsonPathStep, int, error) {
+	if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+		quote := s[1]
+		var name strings.Builder
+		for i := 2; i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && i+1 < len(s):
+				i++
+				name.WriteByte(s[i])
+			case s[i] == quote:
+				if i+1 >= len(s) || s[i+1] != ']' {
+					return jsonPathStep{}, 0, fmt.Errorf("missing ']' after name")
+				}
+				return jsonPathStep{name: name.String()}, i + 2, nil
+			default:
+				name.WriteByte(s[i])
+			}
+		}
+		return jsonPathStep{}, 0, fmt.Errorf("unterminated name")
+	}
+
+	end := strings.Index(s, "]")
+	if end == -1 {
+		return jsonPathStep{}, 0, fmt.Errorf("missing ']'")
+	}
+	inner := strings.TrimSpace(s[1:end])
+	if inner == "*" {
+		return jsonPathStep{wildcard: true}, end + 1, nil
+	}
+	i, err := strconv.Atoi(inner)
+	if err != nil {
+		return jsonPathStep{}, 0, fmt.Errorf("bad index '%s'", inner)
+	}
+	return jsonPathStep{index: i, isIndex: true}, end + 1, nil
+}
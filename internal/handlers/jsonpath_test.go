@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSelectPath(t *testing.T) {
+	var doc interface{}
+	body := `{"values": {"Login ID": "admin", "a/b": 1, "m~n": 2},
+		"entries": [{"values": {"Status": "Pending"}}, {"values": {"Status": "Approved"}}]}`
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name    string
+		Path    string
+		Want    []interface{}
+		WantErr bool
+	}{
+		{Name: "JSONPath bracket name", Path: "$.values['Login ID']", Want: []interface{}{"admin"}},
+		{Name: "JSONPath double quoted name", Path: `$["values"]["Login ID"]`, Want: []interface{}{"admin"}},
+		{Name: "JSONPath index", Path: "$.entries[1].values.Status", Want: []interface{}{"Approved"}},
+		{Name: "JSONPath negative index", Path: "$.entries[-2].values.Status", Want: []interface{}{"Pending"}},
+		{Name: "JSONPath wildcard", Path: "$.entries[*].values.Status", Want: []interface{}{"Pending", "Approved"}},
+		{Name: "JSONPath recursive descent", Path: "$..Status", Want: []interface{}{"Pending", "Approved"}},
+		{Name: "JSONPath nothing selected", Path: "$.values.missing"},
+		{Name: "JSONPath bad index", Path: "$.entries[x]", WantErr: true},
+		{Name: "JSON Pointer", Path: "/values/Login ID", Want: []interface{}{"admin"}},
+		{Name: "JSON Pointer escapes", Path: "/values/a~1b", Want: []interface{}{1.0}},
+		{Name: "JSON Pointer tilde escape", Path: "/values/m~0n", Want: []interface{}{2.0}},
+		{Name: "JSON Pointer index", Path: "/entries/0/values/Status", Want: []interface{}{"Pending"}},
+		{Name: "JSON Pointer nothing selected", Path: "/entries/5"},
+		{Name: "Bad path", Path: "values", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := selectPath(doc, tc.Path)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wrong error: got %v want error %v", err, tc.WantErr)
+			}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("wrong values selected: got %v want %v", got, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Difference is a way in which a request differs from the expectations of a mock, the
+// Section is the part of the request, such as `headers` or `body`, and the Detail says how
+type Difference struct {
+	Section string `json:"section"`
+	Detail  string `json:"detail"`
+}
+
+// Sections of a request compared with a mock, in the order they are checked
+const (
+	sectionEndPoint       = "endPoint"
+	sectionVerb           = "verb"
+	sectionScenario       = "scenario"
+	sectionPathParams     = "pathParams"
+	sectionQuery          = "query"
+	sectionHeaders        = "headers"
+	sectionSchema         = "schema"
+	sectionBody           = "body"
+	sectionBodyAssertions = "bodyAssertions"
+)
+
+// sectionMessages introduce the differences in a section when a candidate does not match
+var sectionMessages = map[string]string{
+	sectionScenario:       "%s",
+	sectionPathParams:     "Request Path Parameters do not meet expectations. %s",
+	sectionQuery:          "Request Query does not meet expectations. %s",
+	sectionHeaders:        "Request Headers do not meet expectations. %s",
+	sectionSchema:         "Request Body does not match schema. %s",
+	sectionBody:           "Request Body does not meet expectations. %s",
+	sectionBodyAssertions: "Request Body Assertions failed. %s",
+}
+
+// checkRequest checks the request meets the expectations of a candidate mock, it returns
+// an empty string when the request is a match, otherwise a detail of how it was not a match
+// in the first section of the request which differs. The body is the raw request body and
+// reqBody the properties parsed from it
+func checkRequest(c Candidate, r *http.Request, body []byte, reqBody mocks.Properties) string {
+	diffs := requestDifferences(c, r, body, reqBody)
+	if len(diffs) == 0 {
+		return ""
+	}
+
+	section := diffs[0].Section
+	var details []string
+	for _, d := range diffs {
+		if d.Section == section {
+			details = append(details, d.Detail)
+		}
+	}
+	return fmt.Sprintf(sectionMessages[section], strings.Join(details, ", "))
+}
+
+// requestDifferences compares the request with every expectation of a candidate mock,
+// returning all the differences found in the order the sections are checked
+func requestDifferences(c Candidate, r *http.Request, body []byte, reqBody mocks.Properties) []Difference {
+	mock := c.Mock
+	var diffs []Difference
+	add := func(section string, details ...string) {
+		for _, d := range details {
+			diffs = append(diffs, Difference{Section: section, Detail: d})
+		}
+	}
+
+	// scenario state
+	if mock.Scenario != "" && mock.RequiredState != "" {
+		if state := State.ScenarioState(mock.Scenario); state != mock.RequiredState {
+			add(sectionScenario, fmt.Sprintf("Scenario '%s' is in state '%s', wanted '%s'", mock.Scenario, state, mock.RequiredState))
+		}
+	}
+
+	// path parameters
+	for _, mk := range sortedKeys(mock.Request.PathParams) {
+		pv, ok := c.PathParams[mk]
+		add(sectionPathParams, matchField(fmt.Sprintf("path parameter '%s'", mk), mock.Request.PathParams[mk], pv, ok)...)
+	}
+
+	// query string parameters
+	add(sectionQuery, matchQuery(mock.Request.Query, r.URL.Query())...)
+
+	// request headers
+	for _, mk := range sortedKeys(mock.Request.Headers) {
+		values := r.Header.Values(mk)
+		var hv interface{}
+		if len(values) > 0 {
+			hv = values[0]
+		}
+		add(sectionHeaders, matchField(fmt.Sprintf("header '%s'", mk), mock.Request.Headers[mk], hv, len(values) > 0)...)
+	}
+
+	// request body schema
+	add(sectionSchema, matchSchema(mock.Request, body)...)
+
+	// request body
+	add(sectionBody, matchBody(mock.Request.Body, reqBody)...)
+
+	// request body assertions
+	add(sectionBodyAssertions, matchAssertions(mock.Request.BodyAssertions, reqBody)...)
+
+	return diffs
+}
+
+// matchAssertions evaluates each assertion against the request body, every value selected
+// by the path must match. When nothing is selected the value is treated as not present, so
+// only operators such as `$absent` will match
+func matchAssertions(assertions []mocks.Assertion, reqBody mocks.Properties) []string {
+	var failures []string
+	for _, a := range assertions {
+		nodes, err := selectPath(map[string]interface{}(reqBody), a.Path)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if len(nodes) == 0 {
+			failures = append(failures, matchField(a.Path, a.Value, nil, false)...)
+			continue
+		}
+		for _, node := range nodes {
+			failures = append(failures, matchField(a.Path, a.Value, node, true)...)
+		}
+	}
+	return failures
+}
+
+// matchBody structurally compares the expected body with the request body, it returns
+// a description of each difference prefixed with the JSON path at which it was found
+func matchBody(want, got mocks.Properties) []string {
+	if len(want) == 0 {
+		return nil
+	}
+	return matchValue("$", map[string]interface{}(want), map[string]interface{}(got))
+}
+
+// matchField compares an expected value with a value which may not have been received,
+// a missing value only matches an operator which accepts it such as `$absent`
+func matchField(path string, want, got interface{}, present bool) []string {
+	if ops, ok := operatorObject(want); ok {
+		return applyOperators(path, ops, got, present)
+	}
+	if !present {
+		return []string{fmt.Sprintf("%s: missing", path)}
+	}
+	return matchValue(path, want, got)
+}
+
+// matchValue recursively compares an expected value with the value received, objects
+// must contain each expected property (additional properties are allowed), arrays must
+// be the same length with each element matching, numbers are compared by value and
+// strings, booleans and nulls must be equal. An expected value may be an object of
+// match operators in which case the value is checked by the operators instead
+func matchValue(path string, want, got interface{}) []string {
+	if ops, ok := operatorObject(want); ok {
+		return applyOperators(path, ops, got, true)
+	}
+	want, got = normalise(want), normalise(got)
+
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: wanted an object got %s", path, describe(got))}
+		}
+		var failures []string
+		for _, k := range sortedKeys(w) {
+			gv, ok := g[k]
+			failures = append(failures, matchField(childPath(path, k), w[k], gv, ok)...)
+		}
+		return failures
+
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: wanted an array got %s", path, describe(got))}
+		}
+		if len(w) != len(g) {
+			return []string{fmt.Sprintf("%s: wanted %d items got %d", path, len(w), len(g))}
+		}
+		var failures []string
+		for i := range w {
+			failures = append(failures, matchValue(fmt.Sprintf("%s[%d]", path, i), w[i], g[i])...)
+		}
+		return failures
+
+	case float64:
+		if g, ok := got.(float64); !ok || g != w {
+			return []string{fmt.Sprintf("%s: wanted %v got %s", path, w, describe(got))}
+		}
+
+	case nil:
+		if got != nil {
+			return []string{fmt.Sprintf("%s: wanted null got %s", path, describe(got))}
+		}
+
+	default:
+		if want != got {
+			return []string{fmt.Sprintf("%s: wanted %s got %s", path, describe(want), describe(got))}
+		}
+	}
+
+	return nil
+}
+
+// normalise converts values to the types produced by unmarshaling json, so mocks
+// declared in Go using any map, slice or numeric type compare with the request body
+func normalise(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, string, bool, float64, map[string]interface{}, []interface{}:
+		return v
+	case mocks.Properties:
+		return map[string]interface{}(val)
+	case json.Number:
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = iter.Value().Interface()
+		}
+		return out
+	}
+	return v
+}
+
+// describe formats a value for a failure description
+func describe(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", val)
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// childPath appends a property name to a JSON path, names which are not simple
+// identifiers use bracket notation e.g. `$.values['Login ID']`
+func childPath(path, key string) string {
+	simple := key != ""
+	for i, c := range key {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		simple = false
+		break
+	}
+	if simple {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s['%s']", path, strings.ReplaceAll(key, "'", "\\'"))
+}
+
+// parseRequestBody parses the request body to properties, form encoded bodies are
+// parsed to their key value pairs, otherwise the body is expected to be json
+func parseRequestBody(contentType string, body []byte) (mocks.Properties, error) {
+	reqBody := mocks.Properties{}
+	if len(body) == 0 {
+		return reqBody, nil
+	}
+
+	// the media type is compared without its parameters, such as `; charset=UTF-8`
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return mocks.Properties{}, err
+		}
+		// a field given once is a string, a field repeated is a list of its values
+		for k, v := range values {
+			if len(v) == 1 {
+				reqBody[k] = v[0]
+				continue
+			}
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				list[i] = item
+			}
+			reqBody[k] = list
+		}
+		return reqBody, nil
+	}
+
+	// json to unmarshal
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return mocks.Properties{}, err
+	}
+	return reqBody, nil
+}
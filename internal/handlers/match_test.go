@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"reflect"
+	"testing"
+)
+
+func TestMatchBody(t *testing.T) {
+	want := mocks.Properties{
+		"values": mocks.Properties{
+			"Login ID":   "admin",
+			"z1D Action": "CREATE",
+			"Quantity":   2,
+			"Urgent":     false,
+			"Notes":      nil,
+			"Tags":       []string{"vm", "linux"},
+		},
+	}
+
+	testCases := []struct {
+		Name         string
+		Body         string
+		WantFailures []string
+	}{
+		{
+			Name: "Good, nested body matches, additional properties allowed",
+			Body: `{"values": {"Login ID": "admin", "z1D Action": "CREATE", "Quantity": 2.0, "Urgent": false,
+				"Notes": null, "Tags": ["vm", "linux"], "Extra": "ignored"}}`,
+		},
+		{
+			Name: "Bad, nested string not match",
+			Body: `{"values": {"Login ID": "guest", "z1D Action": "CREATE", "Quantity": 2, "Urgent": false,
+				"Notes": null, "Tags": ["vm", "linux"]}}`,
+			WantFailures: []string{`$.values['Login ID']: wanted "admin" got "guest"`},
+		},
+		{
+			Name: "Bad, number, boolean and null not match",
+			Body: `{"values": {"Login ID": "admin", "z1D Action": "CREATE", "Quantity": "2", "Urgent": true,
+				"Notes": "", "Tags": ["vm", "linux"]}}`,
+			WantFailures: []string{
+				`$.values.Notes: wanted null got ""`,
+				`$.values.Quantity: wanted 2 got "2"`,
+				`$.values.Urgent: wanted false got true`,
+			},
+		},
+		{
+			Name: "Bad, array item and missing property",
+			Body: `{"values": {"Login ID": "admin", "Quantity": 2, "Urgent": false, "Notes": null,
+				"Tags": ["vm", "windows"]}}`,
+			WantFailures: []string{
+				`$.values.Tags[1]: wanted "linux" got "windows"`,
+				`$.values['z1D Action']: missing`,
+			},
+		},
+		{
+			Name:         "Bad, object expected",
+			Body:         `{"values": ["admin"]}`,
+			WantFailures: []string{`$.values: wanted an object got an array`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got := mocks.Properties{}
+			if err := json.Unmarshal([]byte(tc.Body), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			failures := matchBody(want, got)
+			if !reflect.DeepEqual(failures, tc.WantFailures) {
+				t.Errorf("wrong failures: got %q want %q", failures, tc.WantFailures)
+			}
+		})
+	}
+}
+
+func TestMatchAssertions(t *testing.T) {
+	got := mocks.Properties{}
+	body := `{"values": {"Login ID": "admin", "SR Type Field 10": "Medium", "Quantity": 3}}`
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name         string
+		Assertions   []mocks.Assertion
+		WantFailures []string
+	}{
+		{
+			Name: "Good, exact values and operators",
+			Assertions: []mocks.Assertion{
+				{Path: "$.values['Login ID']", Value: "admin"},
+				{Path: "/values/SR Type Field 10", Value: mocks.Properties{"$oneOf": []string{"Low", "Medium"}}},
+				{Path: "$.values.Quantity", Value: mocks.Properties{"$gte": 1}},
+				{Path: "$.values.Notes", Value: mocks.Properties{"$absent": true}},
+			},
+		},
+		{
+			Name: "Bad, each failing path reported",
+			Assertions: []mocks.Assertion{
+				{Path: "$.values['Login ID']", Value: "guest"},
+				{Path: "$.values.Notes", Value: "none"},
+			},
+			WantFailures: []string{
+				`$.values['Login ID']: wanted "guest" got "admin"`,
+				`$.values.Notes: missing`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			failures := matchAssertions(tc.Assertions, got)
+			if !reflect.DeepEqual(failures, tc.WantFailures) {
+				t.Errorf("wrong failures: got %q want %q", failures, tc.WantFailures)
+			}
+		})
+	}
+}
+
+func TestParseRequestBody(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		ContentType string
+		Body        string
+		Want        mocks.Properties
+		WantErr     bool
+	}{
+		{
+			Name:        "Form keys and values unescaped",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "Login+ID=Allen%20Allbrook&z1D%20Action=CREATE",
+			Want:        mocks.Properties{"Login ID": "Allen Allbrook", "z1D Action": "CREATE"},
+		},
+		{
+			Name:        "Form with a charset",
+			ContentType: "application/x-www-form-urlencoded; charset=UTF-8",
+			Body:        "status=Approved",
+			Want:        mocks.Properties{"status": "Approved"},
+		},
+		{
+			Name:        "Form field repeated",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "tag=vm&tag=linux",
+			Want:        mocks.Properties{"tag": []interface{}{"vm", "linux"}},
+		},
+		{
+			Name:        "Bad form escape",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "status=%zz",
+			Want:        mocks.Properties{},
+			WantErr:     true,
+		},
+		{
+			Name:        "JSON",
+			ContentType: "application/json; charset=utf-8",
+			Body:        `{"status": "Approved"}`,
+			Want:        mocks.Properties{"status": "Approved"},
+		},
+		{
+			Name: "Empty body",
+			Want: mocks.Properties{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := parseRequestBody(tc.ContentType, []byte(tc.Body))
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wrong error: got %v want error %v", err, tc.WantErr)
+			}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("wrong body: got %v want %v", got, tc.Want)
+			}
+		})
+	}
+}
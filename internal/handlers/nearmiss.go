@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// nearMissLimit is the number of closest mocks reported for an unmatched request
+const nearMissLimit = 3
+
+// nearMissThreshold is the lowest score of a near miss, mocks which score less are unrelated
+// to the request
+const nearMissThreshold = 0.5
+
+// NearMiss is a cached mock which came close to matching a request, the Score is the
+// similarity from 0 to 1 and the Differences say how the request differed from the mock
+type NearMiss struct {
+	MockID      string       `json:"mockId"`
+	EndPoint    string       `json:"endPoint"`
+	Verb        string       `json:"verb"`
+	Score       float64      `json:"score"`
+	Differences []Difference `json:"differences"`
+}
+
+// nearMisses ranks the cached mocks by their similarity to the request, returning the
+// closest. Similarity is weighted across the endpoint, the verb and the other request
+// expectations of the mock such as headers and body fields. A mock whose endpoint has
+// nothing in common with the request, or which scores below the threshold, is not a near miss
+func nearMisses(r *http.Request, body []byte, reqBody mocks.Properties, limit int) []NearMiss {
+	reqSegments := splitPath(r.URL.EscapedPath())
+
+	var misses []NearMiss
+	for i, mock := range MocksCache.Mocks() {
+		route := newRoute(mock, i)
+		var diffs []Difference
+
+		endPointScore := 1.0
+		params, ok := route.matchPath(reqSegments)
+		if !ok {
+			endPointScore = segmentSimilarity(route.segments, reqSegments)
+			diffs = append(diffs, Difference{
+				Section: sectionEndPoint,
+				Detail:  fmt.Sprintf("wanted '%s' got '%s'", mock.EndPoint, r.URL.Path),
+			})
+		}
+		if query := matchQuery(route.query, r.URL.Query()); len(query) > 0 {
+			for _, d := range query {
+				diffs = append(diffs, Difference{Section: sectionQuery, Detail: d})
+			}
+		}
+
+		verbScore := 1.0
+		if route.verb != strings.ToUpper(r.Method) {
+			verbScore = 0
+			diffs = append(diffs, Difference{
+				Section: sectionVerb,
+				Detail:  fmt.Sprintf("wanted %s got %s", route.verb, strings.ToUpper(r.Method)),
+			})
+		}
+
+		reqDiffs := requestDifferences(Candidate{Mock: mock, PathParams: params}, r, body, reqBody)
+		diffs = append(diffs, reqDiffs...)
+		if len(diffs) == 0 {
+			// a mock which matches is not a near miss, it may have been passed over for
+			// its response sequence or scenario state changing
+			continue
+		}
+
+		expectations := countExpectations(mock)
+		requestScore := 1.0
+		if len(reqDiffs) > 0 {
+			requestScore = 1 - float64(len(reqDiffs))/math.Max(float64(expectations), float64(len(reqDiffs)))
+		}
+
+		score := 0.4*endPointScore + 0.2*verbScore + 0.4*requestScore
+		if endPointScore == 0 || score < nearMissThreshold {
+			continue
+		}
+		misses = append(misses, NearMiss{
+			MockID:      mock.ID,
+			EndPoint:    mock.EndPoint,
+			Verb:        route.verb,
+			Score:       math.Round(score*100) / 100,
+			Differences: diffs,
+		})
+	}
+
+	sort.SliceStable(misses, func(i, j int) bool { return misses[i].Score > misses[j].Score })
+	if len(misses) > limit {
+		misses = misses[:limit]
+	}
+	return misses
+}
+
+// segmentSimilarity compares an endpoint template with the request path segment by
+// segment, a parameter segment is similar to any value. The empty segment before a leading
+// slash is not compared, so paths with nothing in common have no similarity
+func segmentSimilarity(template, reqSegments []string) float64 {
+	if len(template) > 0 && template[0] == "" {
+		template = template[1:]
+	}
+	if len(reqSegments) > 0 && reqSegments[0] == "" {
+		reqSegments = reqSegments[1:]
+	}
+
+	longest := len(template)
+	if len(reqSegments) > longest {
+		longest = len(reqSegments)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	same := 0
+	for i := 0; i < len(template) && i < len(reqSegments); i++ {
+		if _, ok := paramName(template[i]); ok || template[i] == reqSegments[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(longest)
+}
+
+// countExpectations counts the expectations a mock has of a request beyond its endpoint
+// and verb, each expected header, parameter and body field is one
+func countExpectations(mock mocks.Mock) int {
+	req := mock.Request
+	n := len(req.PathParams) + len(req.Headers) + len(req.Query.Required) + len(req.Query.Optional) +
+		len(req.Query.Forbidden) + len(req.BodyAssertions) + countLeaves(map[string]interface{}(req.Body))
+	if req.Schema != nil || req.SchemaFile != "" {
+		n++
+	}
+	if mock.Scenario != "" && mock.RequiredState != "" {
+		n++
+	}
+	return n
+}
+
+// countLeaves counts the values in a body which are not objects or arrays, an object of
+// match operators counts as one
+func countLeaves(v interface{}) int {
+	if _, ok := operatorObject(v); ok {
+		return 1
+	}
+	switch val := normalise(v).(type) {
+	case map[string]interface{}:
+		n := 0
+		for _, item := range val {
+			n += countLeaves(item)
+		}
+		return n
+	case []interface{}:
+		n := 0
+		for _, item := range val {
+			n += countLeaves(item)
+		}
+		return n
+	}
+	return 1
+}
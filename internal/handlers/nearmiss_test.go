@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNearMisses(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+	defer func(journal *RequestJournal) { Journal = journal }(Journal)
+	Journal = NewRequestJournal(100)
+
+	for _, mock := range []mocks.Mock{
+		{
+			ID:       "create-order",
+			EndPoint: "/orders",
+			Request: mocks.Request{
+				Verb:    "POST",
+				Headers: mocks.Properties{"Authorization": "token"},
+				Body:    mocks.Properties{"item": "book", "quantity": 1},
+			},
+			Response: mocks.Response{StatusCode: http.StatusCreated},
+		},
+		{
+			ID:       "get-order",
+			EndPoint: "/orders/{id}",
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{StatusCode: http.StatusOK},
+		},
+		{
+			ID:       "get-customer",
+			EndPoint: "/customers/{id}",
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{StatusCode: http.StatusOK},
+		},
+	} {
+		MocksCache.Add(mock)
+	}
+
+	testCases := []struct {
+		Name            string
+		Method          string
+		URL             string
+		Body            string
+		WantStatus      int
+		WantIDs         []string
+		WantSections    []string
+		WantDifferences []string
+	}{
+		{
+			Name:            "Header and body field differ",
+			Method:          "POST",
+			URL:             "/orders",
+			Body:            `{"item": "pen", "quantity": 1}`,
+			WantStatus:      http.StatusNotAcceptable,
+			WantIDs:         []string{"create-order", "get-order"},
+			WantSections:    []string{sectionHeaders, sectionBody},
+			WantDifferences: []string{"header 'Authorization': missing", `$.item: wanted "book" got "pen"`},
+		},
+		{
+			Name:            "Verb differs",
+			Method:          "DELETE",
+			URL:             "/orders/7",
+			WantStatus:      http.StatusBadRequest,
+			WantIDs:         []string{"get-order", "get-customer"},
+			WantSections:    []string{sectionVerb},
+			WantDifferences: []string{"wanted GET got DELETE"},
+		},
+		{
+			Name:            "Endpoint differs",
+			Method:          "GET",
+			URL:             "/order/7",
+			WantStatus:      http.StatusBadRequest,
+			WantIDs:         []string{"get-order", "get-customer"},
+			WantSections:    []string{sectionEndPoint},
+			WantDifferences: []string{"wanted '/orders/{id}' got '/order/7'"},
+		},
+		{
+			Name:       "Nothing close",
+			Method:     "PUT",
+			URL:        "/invoices",
+			WantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.Handler, tc.Method, tc.URL, []byte(tc.Body))
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+
+			var res MockErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, miss := range res.NearMisses {
+				ids = append(ids, miss.MockID)
+			}
+			if !reflect.DeepEqual(ids, tc.WantIDs) {
+				t.Errorf("wrong near misses: got %v want %v", ids, tc.WantIDs)
+			}
+			if len(res.NearMisses) == 0 {
+				return
+			}
+
+			closest := res.NearMisses[0]
+			var sections, details []string
+			for _, d := range closest.Differences {
+				sections = append(sections, d.Section)
+				details = append(details, d.Detail)
+			}
+			if !reflect.DeepEqual(sections, tc.WantSections) || !reflect.DeepEqual(details, tc.WantDifferences) {
+				t.Errorf("wrong differences: got %v %q want %v %q", sections, details, tc.WantSections, tc.WantDifferences)
+			}
+			for i := 1; i < len(res.NearMisses); i++ {
+				if res.NearMisses[i].Score > res.NearMisses[i-1].Score {
+					t.Errorf("near misses not ranked by score: %v", res.NearMisses)
+				}
+			}
+		})
+	}
+
+	// the requests no mock matched are listed
+	doRequest(t, app.Handler, "GET", "/customers/3", nil)
+	rr := doRequest(t, app.Admin, "GET", "/__admin/requests/unmatched", nil)
+	var res RequestsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, e := range res.Requests {
+		urls = append(urls, e.URL)
+	}
+	if want := []string{"/orders", "/orders/7", "/order/7", "/invoices"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("wrong unmatched requests: got %v want %v", urls, want)
+	}
+}
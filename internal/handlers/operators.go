@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Matcher is a match operator which can be used in place of an expected value in the
+// headers, query and body of a mock request, e.g. `{"$regex": "^AR-JWT .+"}`.
+// It is given the argument of the operator from the mock, the value received and whether
+// the value was received at all. It returns an error describing why the value does not match
+type Matcher func(arg interface{}, got interface{}, present bool) error
+
+// MatcherProvider can be implemented by packaged mocks which need their own match
+// operators, the operators are registered when the package is loaded
+type MatcherProvider interface {
+	Matchers() map[string]Matcher
+}
+
+var (
+	matchersMu sync.RWMutex
+	matchers   = map[string]Matcher{}
+)
+
+// register the built in match operators, this is done in init as some
+// operators match values recursively which refers back to the registry
+func init() {
+	builtins := map[string]Matcher{
+		"$regex":    regexMatcher,
+		"$contains": containsMatcher,
+		"$exists":   existsMatcher,
+		"$absent":   absentMatcher,
+		"$oneOf":    oneOfMatcher,
+		"$gt":       rangeMatcher(func(g, a float64) bool { return g > a }, "greater than"),
+		"$gte":      rangeMatcher(func(g, a float64) bool { return g >= a }, "at least"),
+		"$lt":       rangeMatcher(func(g, a float64) bool { return g < a }, "less than"),
+		"$lte":      rangeMatcher(func(g, a float64) bool { return g <= a }, "at most"),
+		"$any":      anyMatcher,
+	}
+	for name, m := range builtins {
+		RegisterMatcher(name, m)
+	}
+}
+
+// RegisterMatcher adds a match operator, or replaces an existing one with the same
+// name. Operator names are prefixed with `$`, which is added if missing
+func RegisterMatcher(name string, m Matcher) {
+	if !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+	matchers[name] = m
+}
+
+// operatorObject returns the expected value as a map of operators when it is an
+// object whose keys are all prefixed with `$`
+func operatorObject(want interface{}) (map[string]interface{}, bool) {
+	obj, ok := normalise(want).(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return nil, false
+	}
+	for k := range obj {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// applyOperators checks the value against each operator in the object, all must match
+func applyOperators(path string, ops map[string]interface{}, got interface{}, present bool) []string {
+	var failures []string
+
+	for _, name := range sortedKeys(ops) {
+		matchersMu.RLock()
+		m, ok := matchers[name]
+		matchersMu.RUnlock()
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: unknown match operator '%s'", path, name))
+			continue
+		}
+		if err := m(ops[name], normalise(got), present); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	return failures
+}
+
+// regexCache holds compiled $regex patterns
+var regexCache sync.Map
+
+func regexMatcher(arg interface{}, got interface{}, present bool) error {
+	pattern, ok := arg.(string)
+	if !ok {
+		return errors.New("$regex wants a string pattern")
+	}
+
+	var re *regexp.Regexp
+	if cached, ok := regexCache.Load(pattern); ok {
+		re = cached.(*regexp.Regexp)
+	} else {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("bad $regex pattern (%v)", err)
+		}
+		regexCache.Store(pattern, re)
+	}
+
+	s, ok := got.(string)
+	if !present || !ok || !re.MatchString(s) {
+		return fmt.Errorf("wanted a match for /%s/ got %s", pattern, describeReceived(got, present))
+	}
+	return nil
+}
+
+func containsMatcher(arg interface{}, got interface{}, present bool) error {
+	switch g := got.(type) {
+	case string:
+		if sub, ok := arg.(string); ok && strings.Contains(g, sub) {
+			return nil
+		}
+	case []interface{}:
+		for _, item := range g {
+			if len(matchValue("", arg, item)) == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("wanted a value containing %s got %s", describe(normalise(arg)), describeReceived(got, present))
+}
+
+func existsMatcher(arg interface{}, got interface{}, present bool) error {
+	want, ok := arg.(bool)
+	if !ok {
+		return errors.New("$exists wants a boolean")
+	}
+	if present != want {
+		if want {
+			return errors.New("missing")
+		}
+		return fmt.Errorf("wanted no value got %s", describe(got))
+	}
+	return nil
+}
+
+func absentMatcher(arg interface{}, got interface{}, present bool) error {
+	want, ok := arg.(bool)
+	if !ok {
+		return errors.New("$absent wants a boolean")
+	}
+	return existsMatcher(!want, got, present)
+}
+
+func oneOfMatcher(arg interface{}, got interface{}, present bool) error {
+	options, ok := normalise(arg).([]interface{})
+	if !ok {
+		return errors.New("$oneOf wants an array")
+	}
+	if present {
+		for _, option := range options {
+			if len(matchValue("", option, got)) == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("wanted one of %v got %s", options, describeReceived(got, present))
+}
+
+// rangeMatcher returns a numeric comparison operator, string values such as
+// those of headers and query parameters are parsed as numbers
+func rangeMatcher(cmp func(got, arg float64) bool, desc string) Matcher {
+	return func(arg interface{}, got interface{}, present bool) error {
+		a, ok := normalise(arg).(float64)
+		if !ok {
+			return fmt.Errorf("numeric range operators want a number, got %v", arg)
+		}
+
+		g, ok := got.(float64)
+		if s, isString := got.(string); isString {
+			f, err := strconv.ParseFloat(s, 64)
+			g, ok = f, err == nil
+		}
+		if !present || !ok || !cmp(g, a) {
+			return fmt.Errorf("wanted a number %s %v got %s", desc, a, describeReceived(got, present))
+		}
+		return nil
+	}
+}
+
+func anyMatcher(arg interface{}, got interface{}, present bool) error {
+	return nil
+}
+
+// describeReceived formats a received value for a failure description
+func describeReceived(got interface{}, present bool) string {
+	if !present {
+		return "nothing"
+	}
+	return describe(got)
+}
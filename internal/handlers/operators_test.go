@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	RegisterMatcher("even", func(arg interface{}, got interface{}, present bool) error {
+		if n, ok := got.(float64); ok && int(n)%2 == 0 {
+			return nil
+		}
+		return errors.New("wanted an even number")
+	})
+
+	testCases := []struct {
+		Name        string
+		Want        interface{}
+		Got         interface{}
+		Present     bool
+		WantFailure bool
+	}{
+		{Name: "Good, $regex", Want: mocks.Properties{"$regex": "^AR-JWT .+"}, Got: "AR-JWT abc", Present: true},
+		{Name: "Bad, $regex", Want: mocks.Properties{"$regex": "^AR-JWT .+"}, Got: "Bearer abc", Present: true, WantFailure: true},
+		{Name: "Bad, $regex bad pattern", Want: mocks.Properties{"$regex": "("}, Got: "(", Present: true, WantFailure: true},
+		{Name: "Good, $contains string", Want: mocks.Properties{"$contains": "Desk"}, Got: "Help Desk", Present: true},
+		{Name: "Good, $contains array", Want: mocks.Properties{"$contains": 2}, Got: []interface{}{1.0, 2.0}, Present: true},
+		{Name: "Bad, $contains", Want: mocks.Properties{"$contains": "x"}, Got: "Help Desk", Present: true, WantFailure: true},
+		{Name: "Good, $exists", Want: mocks.Properties{"$exists": true}, Got: "", Present: true},
+		{Name: "Bad, $exists", Want: mocks.Properties{"$exists": true}, Present: false, WantFailure: true},
+		{Name: "Good, $absent", Want: mocks.Properties{"$absent": true}, Present: false},
+		{Name: "Bad, $absent", Want: mocks.Properties{"$absent": true}, Got: "x", Present: true, WantFailure: true},
+		{Name: "Good, $oneOf", Want: mocks.Properties{"$oneOf": []string{"Low", "Medium"}}, Got: "Medium", Present: true},
+		{Name: "Bad, $oneOf", Want: mocks.Properties{"$oneOf": []string{"Low", "Medium"}}, Got: "High", Present: true, WantFailure: true},
+		{Name: "Good, numeric range", Want: mocks.Properties{"$gte": 1, "$lt": 10}, Got: 9.5, Present: true},
+		{Name: "Good, numeric range on string", Want: mocks.Properties{"$gt": 1}, Got: "2", Present: true},
+		{Name: "Bad, numeric range", Want: mocks.Properties{"$gte": 1, "$lt": 10}, Got: 10.0, Present: true, WantFailure: true},
+		{Name: "Good, $any", Want: mocks.Properties{"$any": true}, Present: false},
+		{Name: "Good, registered operator", Want: mocks.Properties{"$even": true}, Got: 4.0, Present: true},
+		{Name: "Bad, registered operator", Want: mocks.Properties{"$even": true}, Got: 3.0, Present: true, WantFailure: true},
+		{Name: "Bad, unknown operator", Want: mocks.Properties{"$unknown": true}, Got: "x", Present: true, WantFailure: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			failures := matchField("$.value", tc.Want, tc.Got, tc.Present)
+			if got := len(failures) > 0; got != tc.WantFailure {
+				t.Errorf("wrong match result: got failures %v want failure %v", failures, tc.WantFailure)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Proxy forwards requests to an upstream server, the Headers changes are made to each
+// request forwarded and the upstream response is streamed back to the client
+type Proxy struct {
+	Target  *url.URL
+	Headers mocks.ProxyHeaders
+}
+
+// NewProxy returns a proxy to the target, which should be an absolute http or https url,
+// the path of the request is appended to the path of the target
+func NewProxy(target string, headers *mocks.ProxyHeaders) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy target '%s', it should be an absolute http or https url", target)
+	}
+	p := &Proxy{Target: u}
+	if headers != nil {
+		p.Headers = *headers
+	}
+	return p, nil
+}
+
+// ParseProxy parses the proxy given on the command line, the headers to add are given as
+// `Name: value` and the headers to remove by name
+func ParseProxy(target string, add, remove []string) (*Proxy, error) {
+	if target == "" {
+		return nil, nil
+	}
+	headers := &mocks.ProxyHeaders{Remove: remove}
+	for _, h := range add {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid proxy header '%s', it should be given as 'Name: value'", h)
+		}
+		if headers.Add == nil {
+			headers.Add = mocks.Properties{}
+		}
+		headers.Add[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return NewProxy(target, headers)
+}
+
+// direct rewrites a request to be sent to the upstream
+func (p *Proxy) direct(director func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		director(req)
+		req.Host = p.Target.Host
+		for _, k := range p.Headers.Remove {
+			req.Header.Del(k)
+		}
+		for k, v := range p.Headers.Add {
+			req.Header.Set(k, fmt.Sprint(v))
+		}
+	}
+}
+
+// proxy forwards the request to the upstream and streams its response back, the body is
+// the request body which has already been read. The client receives a 502 if the upstream
+// cannot be reached. The request and response are recorded if the App has a Recorder
+func (a *App) proxy(w http.ResponseWriter, r *http.Request, p *Proxy, body []byte) {
+	a.Logger.Info(fmt.Sprintf("proxying '%s' to '%s'", r.URL, p.Target))
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	rp := httputil.NewSingleHostReverseProxy(p.Target)
+	rp.Director = p.direct(rp.Director)
+	// stream the response, flushing as each part is received
+	rp.FlushInterval = -1
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		a.Logger.Error(fmt.Sprintf("problem proxying '%s' to '%s'", r.URL, p.Target), err)
+		a.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not proxy request to %s", p.Target))
+	}
+	if a.Recorder != nil {
+		rp.ModifyResponse = func(res *http.Response) error {
+			a.recordResponse(r, body, res)
+			return nil
+		}
+	}
+	rp.ServeHTTP(w, r)
+}
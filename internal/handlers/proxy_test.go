@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoUpstream is an upstream which responds with the request it received
+func echoUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream", name)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"query":  r.URL.RawQuery,
+			"token":  r.Header.Get("Authorization"),
+			"secret": r.Header.Get("X-Secret"),
+			"body":   string(body),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxy(t *testing.T) {
+	upstream := echoUpstream(t, "default")
+	other := echoUpstream(t, "other")
+
+	proxy, err := ParseProxy(upstream.URL+"/base", []string{"Authorization: Bearer upstream"}, []string{"X-Secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		Logger: &koan.Logger{},
+		Proxy:  proxy,
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+	defer func(journal *RequestJournal) { Journal = journal }(Journal)
+	Journal = NewRequestJournal(100)
+
+	MocksCache.Add(mocks.Mock{
+		ID:       "mocked",
+		EndPoint: "/mocked",
+		Request:  mocks.Request{Verb: "GET"},
+		Response: mocks.Response{StatusCode: http.StatusOK, RawBody: "mocked"},
+	})
+	MocksCache.Add(mocks.Mock{
+		ID:       "forwarded",
+		EndPoint: "/forwarded/{id}",
+		Request:  mocks.Request{Verb: "POST"},
+		ProxyTo:  other.URL,
+		ProxyHeaders: &mocks.ProxyHeaders{
+			Add: mocks.Properties{"Authorization": "Bearer other"},
+		},
+	})
+
+	testCases := []struct {
+		Name         string
+		Method       string
+		URL          string
+		Body         string
+		WantStatus   int
+		WantUpstream string
+		WantEcho     map[string]string
+		WantMockID   string
+		WantProxied  bool
+	}{
+		{
+			Name:       "Matched mock responds",
+			Method:     "GET",
+			URL:        "/mocked",
+			WantStatus: http.StatusOK,
+			WantMockID: "mocked",
+		},
+		{
+			Name:         "Unmatched request is forwarded with header changes",
+			Method:       "PUT",
+			URL:          "/unmocked?a=1",
+			Body:         `{"name": "ghost"}`,
+			WantStatus:   http.StatusAccepted,
+			WantUpstream: "default",
+			WantEcho: map[string]string{
+				"method": "PUT", "path": "/base/unmocked", "query": "a=1",
+				"token": "Bearer upstream", "secret": "", "body": `{"name": "ghost"}`,
+			},
+			WantProxied: true,
+		},
+		{
+			Name:         "Request not meeting expectations is forwarded",
+			Method:       "DELETE",
+			URL:          "/mocked",
+			WantStatus:   http.StatusAccepted,
+			WantUpstream: "default",
+			WantEcho:     map[string]string{"method": "DELETE", "path": "/base/mocked"},
+			WantProxied:  true,
+		},
+		{
+			Name:         "Mock forwards to its own upstream",
+			Method:       "POST",
+			URL:          "/forwarded/7",
+			Body:         "payload",
+			WantStatus:   http.StatusAccepted,
+			WantUpstream: "other",
+			WantEcho: map[string]string{
+				"method": "POST", "path": "/forwarded/7", "token": "Bearer other", "secret": "kept", "body": "payload",
+			},
+			WantMockID:  "forwarded",
+			WantProxied: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			Journal.Reset()
+			req := httptest.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			req.Header.Set("X-Secret", "kept")
+			rr := httptest.NewRecorder()
+			app.Handler(rr, req)
+
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("X-Upstream"); got != tc.WantUpstream {
+				t.Errorf("wrong upstream: got %v want %v", got, tc.WantUpstream)
+			}
+			if tc.WantEcho != nil {
+				var echo map[string]string
+				if err := json.Unmarshal(rr.Body.Bytes(), &echo); err != nil {
+					t.Fatal(err)
+				}
+				for k, want := range tc.WantEcho {
+					if echo[k] != want {
+						t.Errorf("wrong upstream %s: got %v want %v", k, echo[k], want)
+					}
+				}
+			}
+
+			entries := Journal.Entries(nil)
+			if len(entries) != 1 {
+				t.Fatalf("wrong number of journal entries: got %v want %v", len(entries), 1)
+			}
+			if entries[0].MockID != tc.WantMockID || entries[0].Proxied != tc.WantProxied {
+				t.Errorf("wrong journal entry: got mock '%v' proxied %v want mock '%v' proxied %v",
+					entries[0].MockID, entries[0].Proxied, tc.WantMockID, tc.WantProxied)
+			}
+			if entries[0].Response.StatusCode != tc.WantStatus {
+				t.Errorf("wrong journal response status: got %v want %v", entries[0].Response.StatusCode, tc.WantStatus)
+			}
+		})
+	}
+
+	// an upstream which cannot be reached is a bad gateway
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	app.Proxy, _ = NewProxy(down.URL, nil)
+	rr := doRequest(t, app.Handler, "GET", "/unmocked", nil)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("wrong status code for unreachable upstream: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Target  string
+		Add     []string
+		WantErr bool
+	}{
+		{Name: "Not set", Target: ""},
+		{Name: "Target with headers", Target: "https://api.example.com/v1", Add: []string{"Authorization: Bearer a:b"}},
+		{Name: "Relative target", Target: "/api", WantErr: true},
+		{Name: "Unsupported scheme", Target: "ftp://example.com", WantErr: true},
+		{Name: "Header without value", Target: "http://localhost:8080", Add: []string{"Authorization"}, WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			p, err := ParseProxy(tc.Target, tc.Add, nil)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wrong error: got %v want error %v", err, tc.WantErr)
+			}
+			if tc.Target == "" && p != nil {
+				t.Errorf("proxy should not be set")
+			}
+			if len(tc.Add) > 0 && !tc.WantErr && p.Headers.Add["Authorization"] != "Bearer a:b" {
+				t.Errorf("wrong header: got %v want %v", p.Headers.Add["Authorization"], "Bearer a:b")
+			}
+		})
+	}
+}
+
+func TestProxyStreaming(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewProxy(upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		Logger: &koan.Logger{},
+		Proxy:  proxy,
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+	server := httptest.NewServer(http.HandlerFunc(app.Handler))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// the first part arrives before the upstream has finished its response
+	first := make([]byte, len("first "))
+	if _, err := io.ReadFull(res.Body, first); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	rest, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(first) + string(rest); got != "first second" {
+		t.Errorf("wrong streamed body: got %v want %v", got, "first second")
+	}
+}
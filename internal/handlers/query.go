@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// matchQuery checks the decoded query string parameters of the request against the
+// expectations of the mock, returning a description of each parameter which did not match
+func matchQuery(want mocks.Query, got url.Values) []string {
+	var failures []string
+
+	for _, name := range sortedKeys(want.Required) {
+		values, ok := got[name]
+		failures = append(failures, matchQueryParam(name, want.Required[name], values, ok)...)
+	}
+
+	for _, name := range sortedKeys(want.Optional) {
+		values, ok := got[name]
+		if !ok {
+			continue
+		}
+		failures = append(failures, matchQueryParam(name, want.Optional[name], values, ok)...)
+	}
+
+	for _, name := range want.Forbidden {
+		if _, ok := got[name]; ok {
+			failures = append(failures, fmt.Sprintf("forbidden parameter '%s' is present", name))
+		}
+	}
+
+	return failures
+}
+
+// matchQueryParam checks the values received for a query parameter, the expected value
+// may be an object of match operators which are applied to the first value received
+func matchQueryParam(name string, want interface{}, values []string, present bool) []string {
+	if ops, ok := operatorObject(want); ok {
+		var first interface{}
+		if len(values) > 0 {
+			first = values[0]
+		}
+		return applyOperators(fmt.Sprintf("parameter '%s'", name), ops, first, present)
+	}
+	if !present {
+		return []string{fmt.Sprintf("required parameter '%s' is missing", name)}
+	}
+	if !queryValueMatches(want, values) {
+		return []string{fmt.Sprintf("parameter '%s' wanted %v got %v", name, want, values)}
+	}
+	return nil
+}
+
+// queryValueMatches compares the expected value of a query parameter with the values
+// received, a single expected value must equal the first value received while a list must
+// equal all the values received in order. A nil expected value accepts any value
+func queryValueMatches(want interface{}, values []string) bool {
+	switch w := want.(type) {
+	case nil:
+		return true
+	case []string:
+		return equalStrings(w, values)
+	case []interface{}:
+		strs := make([]string, len(w))
+		for i, item := range w {
+			s, ok := queryScalar(item)
+			if !ok {
+				return false
+			}
+			strs[i] = s
+		}
+		return equalStrings(strs, values)
+	}
+	s, ok := queryScalar(want)
+	return ok && len(values) > 0 && values[0] == s
+}
+
+// queryScalar returns an expected value as it is written in a url, so the numbers and
+// booleans decoded from json or yaml compare with the text received
+func queryScalar(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case int, int64, bool:
+		return fmt.Sprint(s), true
+	}
+	return "", false
+}
+
+// queryFromValues converts parsed query parameters to required mock query parameters
+func queryFromValues(values url.Values) mocks.Properties {
+	props := mocks.Properties{}
+	for name, vals := range values {
+		if len(vals) == 1 {
+			props[name] = vals[0]
+			continue
+		}
+		props[name] = vals
+	}
+	return props
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of the properties in order, so failures are reported consistently
+func sortedKeys(props mocks.Properties) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/url"
+	"testing"
+)
+
+func TestMatchQuery(t *testing.T) {
+	want := mocks.Query{
+		Required: mocks.Properties{
+			"fields": "values(Request Number,Approval Status)",
+			"q":      nil,
+		},
+		Optional: mocks.Properties{
+			"limit":  "10",
+			"page":   float64(1),
+			"expand": true,
+			"ids":    []interface{}{float64(100000000), float64(2)},
+		},
+		Forbidden: []string{"offset"},
+	}
+
+	testCases := []struct {
+		Name        string
+		RawQuery    string
+		WantFailure bool
+	}{
+		{
+			Name:     "Good, required parameters in any order and encoding",
+			RawQuery: "q=anything&fields=values(Request+Number,Approval%20Status)",
+		},
+		{
+			Name:     "Good, optional parameter matches",
+			RawQuery: "fields=values(Request%20Number,Approval%20Status)&q=x&limit=10",
+		},
+		{
+			Name:     "Good, numbers and booleans match as written in the url",
+			RawQuery: "fields=values(Request%20Number,Approval%20Status)&q=x&page=1&expand=true&ids=100000000&ids=2",
+		},
+		{
+			Name:        "Bad, number value not match",
+			RawQuery:    "fields=values(Request%20Number,Approval%20Status)&q=x&page=2",
+			WantFailure: true,
+		},
+		{
+			Name:        "Bad, required parameter missing",
+			RawQuery:    "fields=values(Request%20Number,Approval%20Status)",
+			WantFailure: true,
+		},
+		{
+			Name:        "Bad, required parameter value not match",
+			RawQuery:    "fields=values(Request%20Number)&q=x",
+			WantFailure: true,
+		},
+		{
+			Name:        "Bad, optional parameter value not match",
+			RawQuery:    "fields=values(Request%20Number,Approval%20Status)&q=x&limit=20",
+			WantFailure: true,
+		},
+		{
+			Name:        "Bad, forbidden parameter present",
+			RawQuery:    "fields=values(Request%20Number,Approval%20Status)&q=x&offset=5",
+			WantFailure: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			values, err := url.ParseQuery(tc.RawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failures := matchQuery(want, values)
+			if got := len(failures) > 0; got != tc.WantFailure {
+				t.Errorf("wrong match result: got failures %v want failure %v", failures, tc.WantFailure)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rng is the source of randomness for templates and simulated behaviour, it is
+// guarded as a rand.Rand is not safe for concurrent use
+var rng = struct {
+	sync.Mutex
+	r *rand.Rand
+}{
+	r: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// randIntn returns a random int in [0,n)
+func randIntn(n int) int {
+	rng.Lock()
+	defer rng.Unlock()
+	return rng.r.Intn(n)
+}
+
+// randFloat64 returns a random float64 in [0.0,1.0)
+func randFloat64() float64 {
+	rng.Lock()
+	defer rng.Unlock()
+	return rng.r.Float64()
+}
+
+// randNormFloat64 returns a normally distributed float64 with mean 0 and standard deviation 1
+func randNormFloat64() float64 {
+	rng.Lock()
+	defer rng.Unlock()
+	return rng.r.NormFloat64()
+}
+
+// Seed reseeds the source of randomness, so simulated behaviour such as chaos and
+// faults can be reproduced from run to run
+func Seed(seed int64) {
+	rng.Lock()
+	defer rng.Unlock()
+	rng.r = rand.New(rand.NewSource(seed))
+}
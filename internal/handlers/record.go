@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// volatileHeaders are the response headers which change from one response to the next, or
+// describe the connection rather than the response, they are not recorded
+var volatileHeaders = []string{
+	"Age",
+	"Connection",
+	"Content-Length",
+	"Date",
+	"Etag",
+	"Expires",
+	"Keep-Alive",
+	"Last-Modified",
+	"Set-Cookie",
+	"Transfer-Encoding",
+	"X-Request-Id",
+}
+
+// recordedRequestHeaders are the request headers a recorded mock expects, other request
+// headers vary between clients so are not matched
+var recordedRequestHeaders = []string{
+	"Authorization",
+	"Content-Type",
+}
+
+// Recorder captures the requests proxied to an upstream and the responses received as mocks,
+// identical requests are recorded once. Capturing a mock only marks the recorder as changed,
+// the mocks recorded so far are saved when it is flushed, so proxied requests never wait on
+// the file being written
+type Recorder struct {
+	mu     sync.Mutex
+	mocks  []mocks.Mock
+	seen   map[string]bool
+	ids    map[string]int
+	dirty  bool
+	saving sync.Mutex
+	save   func([]mocks.Mock) error
+}
+
+// NewRecorder returns a recorder which saves the recorded mocks with save, if set
+func NewRecorder(save func([]mocks.Mock) error) *Recorder {
+	return &Recorder{
+		seen: map[string]bool{},
+		ids:  map[string]int{},
+		save: save,
+	}
+}
+
+// Add records a mock unless a mock has already been recorded for the same request, the key
+// identifies the request. It reports whether the mock was added
+func (rec *Recorder) Add(mock mocks.Mock, key string) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.seen[key] {
+		return false
+	}
+	rec.seen[key] = true
+
+	// ids are made from the request, numbered when several requests share one
+	id := recordedID(mock)
+	rec.ids[id]++
+	if n := rec.ids[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	mock.ID = id
+	rec.mocks = append(rec.mocks, mock)
+	rec.dirty = true
+	return true
+}
+
+// Mocks returns the mocks recorded, in the order they were recorded
+func (rec *Recorder) Mocks() []mocks.Mock {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	list := make([]mocks.Mock, len(rec.mocks))
+	copy(list, rec.mocks)
+	return list
+}
+
+// Reset discards the recorded mocks, so recording starts again
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.mocks = nil
+	rec.seen = map[string]bool{}
+	rec.ids = map[string]int{}
+	rec.dirty = true
+}
+
+// Flush saves the recorded mocks if they have changed since they were last saved, it
+// reports whether they were saved. The mocks are saved without holding the lock, so mocks
+// are still recorded while the file is written, and a failed save is tried again by the
+// next flush
+func (rec *Recorder) Flush() (bool, error) {
+	rec.saving.Lock()
+	defer rec.saving.Unlock()
+
+	rec.mu.Lock()
+	if !rec.dirty || rec.save == nil {
+		rec.mu.Unlock()
+		return false, nil
+	}
+	list := make([]mocks.Mock, len(rec.mocks))
+	copy(list, rec.mocks)
+	rec.dirty = false
+	rec.mu.Unlock()
+
+	if err := rec.save(list); err != nil {
+		rec.mu.Lock()
+		rec.dirty = true
+		rec.mu.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// recordResponse records the proxied request and the upstream response as a mock once the
+// response body has been streamed to the client, reqBody is the body of the request
+func (a *App) recordResponse(r *http.Request, reqBody []byte, res *http.Response) {
+	res.Body = &captureBody{
+		ReadCloser: res.Body,
+		done: func(resBody []byte) {
+			mock, key := recordedMock(r, reqBody, res, resBody)
+			if a.Recorder.Add(mock, key) {
+				a.Logger.Info(fmt.Sprintf("recorded mock '%s'", mockKey(mock)))
+			}
+		},
+	}
+}
+
+// recordedMock makes a mock from a request and the upstream response, along with the key
+// which identifies identical requests
+func recordedMock(r *http.Request, reqBody []byte, res *http.Response, resBody []byte) (mocks.Mock, string) {
+	mock := mocks.Mock{
+		EndPoint: r.URL.Path,
+		Request: mocks.Request{
+			Verb: r.Method,
+		},
+		Response: mocks.Response{
+			StatusCode: res.StatusCode,
+		},
+	}
+
+	// the query parameters are required, the first value of each is matched
+	query := r.URL.Query()
+	if len(query) > 0 {
+		mock.Request.Query.Required = mocks.Properties{}
+		for k, v := range query {
+			mock.Request.Query.Required[k] = v[0]
+		}
+	}
+
+	for _, k := range recordedRequestHeaders {
+		v := r.Header.Get(k)
+		if v == "" {
+			continue
+		}
+		if mock.Request.Headers == nil {
+			mock.Request.Headers = mocks.Properties{}
+		}
+		mock.Request.Headers[k] = v
+		// credentials expire, any credential of the same scheme matches
+		if k == "Authorization" {
+			scheme, _, _ := strings.Cut(v, " ")
+			mock.Request.Headers[k] = mocks.Properties{"$regex": "^" + regexp.QuoteMeta(scheme) + " .+"}
+		}
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if body, err := parseRequestBody(contentType, reqBody); err == nil && len(body) > 0 {
+		mock.Request.Body = body
+	}
+
+	for k, v := range res.Header {
+		if containsString(volatileHeaders, k) {
+			continue
+		}
+		if mock.Response.Headers == nil {
+			mock.Response.Headers = mocks.Properties{}
+		}
+		mock.Response.Headers[k] = strings.Join(v, ", ")
+	}
+
+	// text is kept as it is, in a raw body which is not templated so it is replayed exactly,
+	// anything else is base64 encoded
+	if utf8.Valid(resBody) {
+		mock.Response.RawBody = string(resBody)
+	} else {
+		mock.Response.Base64Body = base64.StdEncoding.EncodeToString(resBody)
+	}
+
+	params := make([]string, 0, len(query))
+	for k, v := range query {
+		params = append(params, k+"="+strings.Join(v, ","))
+	}
+	sort.Strings(params)
+	key := strings.Join([]string{r.Method, r.URL.Path, strings.Join(params, "&"), contentType, string(reqBody)}, "\n")
+	return mock, key
+}
+
+// nonAlphanumeric matches the runs of characters which are not used in a recorded mock id
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// recordedID makes an id for a recorded mock from its verb and endpoint e.g.
+// `post-api-jwt-login`
+func recordedID(mock mocks.Mock) string {
+	id := strings.ToLower(mock.Request.Verb + "-" + mock.EndPoint)
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(id, "-"), "-")
+}
+
+// captureBody copies a response body as it is read, once the whole body has been read it is
+// passed to done. A body which is not read to the end is not captured
+type captureBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+// Read reads from the body, keeping a copy
+func (c *captureBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.buf.Write(p[:n])
+	if err == io.EOF {
+		c.once.Do(func() { c.done(c.buf.Bytes()) })
+	}
+	return n, err
+}
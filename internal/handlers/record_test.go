@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("X-Api-Version", "2")
+		switch r.URL.Path {
+		case "/api/jwt/login":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("token-for-" + r.FormValue("username")))
+		case "/api/items":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"items": ["` + r.URL.Query().Get("q") + `"], "link": "{{ .Path.id }}"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte{0xff, 0xfe})
+		}
+	}))
+	defer upstream.Close()
+
+	proxy, err := NewProxy(upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []mocks.Mock
+	app := &App{
+		Logger: &koan.Logger{},
+		Proxy:  proxy,
+		Recorder: NewRecorder(func(list []mocks.Mock) error {
+			saved = list
+			return nil
+		}),
+	}
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	MocksCache = NewRouter()
+
+	send := func(method, url, contentType, auth, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		req.Header.Set("User-Agent", "recorder-test")
+		rr := httptest.NewRecorder()
+		app.Handler(rr, req)
+		return rr
+	}
+
+	form := "application/x-www-form-urlencoded"
+	send("POST", "/api/jwt/login", form, "", "username=admin&password=secret")
+	send("POST", "/api/jwt/login", form, "", "username=admin&password=secret")
+	send("POST", "/api/jwt/login", form, "", "username=demo&password=secret")
+	send("GET", "/api/items?q=book&page=1", "", "AR-JWT abc.def", "")
+	send("GET", "/api/items?page=1&q=book", "", "AR-JWT abc.def", "")
+	send("GET", "/missing", "", "", "")
+
+	// the recorded mocks are saved when the recorder is flushed, once for each change
+	recorded := app.Recorder.Mocks()
+	if saved != nil {
+		t.Errorf("recorded mocks saved before the recorder was flushed")
+	}
+	if ok, err := app.Recorder.Flush(); !ok || err != nil {
+		t.Errorf("recorded mocks not flushed: %v %v", ok, err)
+	}
+	if !reflect.DeepEqual(saved, recorded) {
+		t.Errorf("recorded mocks not saved: got %v want %v", len(saved), len(recorded))
+	}
+	if ok, _ := app.Recorder.Flush(); ok {
+		t.Errorf("unchanged recorded mocks saved again")
+	}
+
+	var ids []string
+	for _, mock := range recorded {
+		ids = append(ids, mock.ID)
+	}
+	wantIDs := []string{"post-api-jwt-login", "post-api-jwt-login-2", "get-api-items", "get-missing"}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Fatalf("wrong mocks recorded: got %v want %v", ids, wantIDs)
+	}
+
+	testCases := []struct {
+		Name string
+		Got  interface{}
+		Want interface{}
+	}{
+		{Name: "Request body", Got: recorded[0].Request.Body, Want: mocks.Properties{"username": "admin", "password": "secret"}},
+		{Name: "Request headers", Got: recorded[0].Request.Headers, Want: mocks.Properties{"Content-Type": form}},
+		{Name: "Response headers without volatile headers", Got: recorded[0].Response.Headers, Want: mocks.Properties{"Content-Type": "text/plain", "X-Api-Version": "2"}},
+		{Name: "Response body", Got: recorded[1].Response.RawBody, Want: "token-for-demo"},
+		{Name: "Query", Got: recorded[2].Request.Query.Required, Want: mocks.Properties{"q": "book", "page": "1"}},
+		{Name: "Authorization matches any credential of the scheme", Got: recorded[2].Request.Headers, Want: mocks.Properties{"Authorization": mocks.Properties{"$regex": "^AR-JWT .+"}}},
+		{Name: "Status", Got: recorded[3].Response.StatusCode, Want: http.StatusNotFound},
+		{Name: "Binary body", Got: recorded[3].Response.Base64Body, Want: "//4="},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.Got, tc.Want) {
+				t.Errorf("wrong recording: got %v want %v", tc.Got, tc.Want)
+			}
+		})
+	}
+
+	// the recorded mocks are valid, and replay the upstream without it exactly, braces and all
+	app.Proxy = nil
+	for _, mock := range recorded {
+		if errs := mock.Validate(); len(errs) > 0 {
+			t.Errorf("recorded mock '%s' is invalid: %v", mock.ID, errs)
+		}
+		MocksCache.Add(mock)
+	}
+	rr := send("GET", "/api/items?page=1&q=book", "", "AR-JWT fresh.token", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"items": ["book"], "link": "{{ .Path.id }}"}` {
+		t.Errorf("wrong replayed response: got %v %s", rr.Code, rr.Body.String())
+	}
+
+	// recordings are listed and discarded through the admin api
+	rr = doRequest(t, app.Admin, "GET", "/__admin/recordings", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "get-api-items") {
+		t.Errorf("wrong recordings listed: got %v %s", rr.Code, rr.Body.String())
+	}
+	doRequest(t, app.Admin, "DELETE", "/__admin/recordings", nil)
+	if len(app.Recorder.Mocks()) != 0 || len(saved) != 0 {
+		t.Errorf("recordings not discarded")
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateData is the request data made available to templated response values, e.g.
+// `{{ .Path.id }}` renders the `id` parameter captured from the request path,
+// `{{ .Query.page }}` the first value of a query parameter, `{{ .Headers.Authorization }}`
+// a request header and `{{ .Body.username }}` a property of the request body
+type templateData struct {
+	Path    map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Body    map[string]interface{}
+	funcs   template.FuncMap
+}
+
+const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// newTemplateData collects the request data for rendering a response along with the
+// template helper functions:
+//
+//	jsonPath "$.values['Login ID']"  the first value at a JSONPath or JSON Pointer in the request body
+//	header "authorization"           a request header, case insensitive
+//	now                              the current time in RFC 3339 format, or in the layout given e.g. now "2006-01-02"
+//	uuid                             a random UUID
+//	randomInt 1 100                  a random integer in the range, inclusive
+//	randomString 8                   a random alphanumeric string of the length
+//	counter "name"                   increments the named counter and returns the new value
+func newTemplateData(r *http.Request, pathParams map[string]string, reqBody mocks.Properties) templateData {
+	data := templateData{
+		Path:    pathParams,
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+		Body:    map[string]interface{}(reqBody),
+	}
+
+	for k, v := range r.URL.Query() {
+		if len(v) > 0 {
+			data.Query[k] = v[0]
+		}
+	}
+	for k := range r.Header {
+		data.Headers[k] = r.Header.Get(k)
+	}
+
+	data.funcs = template.FuncMap{
+		"jsonPath": func(path string) (interface{}, error) {
+			nodes, err := selectPath(data.Body, path)
+			if err != nil || len(nodes) == 0 {
+				return "", err
+			}
+			return nodes[0], nil
+		},
+		"header": func(name string) string {
+			return r.Header.Get(name)
+		},
+		"now": func(layout ...string) string {
+			if len(layout) > 0 {
+				return time.Now().Format(layout[0])
+			}
+			return time.Now().Format(time.RFC3339)
+		},
+		"uuid": newID,
+		"randomInt": func(lo, hi int) int {
+			if hi < lo {
+				lo, hi = hi, lo
+			}
+			return lo + randIntn(hi-lo+1)
+		},
+		"randomString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = charset[randIntn(len(charset))]
+			}
+			return string(b)
+		},
+		"counter": State.Increment,
+	}
+
+	return data
+}
+
+// renderProperties returns a copy of the properties in which any templated string
+// values have been rendered with the request data
+func renderProperties(props mocks.Properties, data templateData) (mocks.Properties, error) {
+	if props == nil {
+		return nil, nil
+	}
+	out, err := renderValue(map[string]interface{}(props), data)
+	if err != nil {
+		return nil, err
+	}
+	return mocks.Properties(out.(map[string]interface{})), nil
+}
+
+// renderValue walks the value rendering templated strings, maps and slices are copied
+// so the cached mock is never modified
+func renderValue(v interface{}, data templateData) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return renderString(val, data)
+	case mocks.Properties:
+		return renderValue(map[string]interface{}(val), data)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []mocks.Properties:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			rendered, err := renderValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// renderString executes the string as a template, strings without an action are
+// returned unchanged
+func renderString(s string, data templateData) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	tmpl, err := template.New("response").Funcs(data.funcs).Funcs(template.FuncMap{orEmptyFunc: orEmpty}).
+		Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template '%s' (%v)", s, err)
+	}
+	appendOrEmpty(tmpl.Tree, tmpl.Root)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// orEmptyFunc is piped the value of each action in a template, missingkey=zero only applies
+// to the string maps so a body field which is missing or null would render `<no value>`
+const orEmptyFunc = "orEmpty"
+
+// orEmpty returns an empty string for a missing value
+func orEmpty(v interface{}) interface{} {
+	if v == nil {
+		return ""
+	}
+	return v
+}
+
+// appendOrEmpty pipes the value of each action which renders output through orEmpty, e.g.
+// `{{ .Body.missing }}` is executed as `{{ .Body.missing | orEmpty }}`
+func appendOrEmpty(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			appendOrEmpty(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		ident := parse.NewIdentifier(orEmptyFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+	case *parse.IfNode:
+		appendOrEmpty(tree, n.List)
+		appendOrEmpty(tree, n.ElseList)
+	case *parse.RangeNode:
+		appendOrEmpty(tree, n.List)
+		appendOrEmpty(tree, n.ElseList)
+	case *parse.WithNode:
+		appendOrEmpty(tree, n.List)
+		appendOrEmpty(tree, n.ElseList)
+	}
+}
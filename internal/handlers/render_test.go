@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestRenderProperties(t *testing.T) {
+	req, err := http.NewRequest("POST", "/api/arsys/v1/entry/SRM:RequestInterface_Create/42?fields=values(Request%20Number)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "AR-JWT token")
+
+	reqBody := mocks.Properties{
+		"values": map[string]interface{}{
+			"Login ID": "admin",
+		},
+		"username": "admin",
+		"note":     nil,
+	}
+	data := newTemplateData(req, map[string]string{"id": "42"}, reqBody)
+
+	testCases := []struct {
+		Name     string
+		Template string
+		Want     string
+		WantLike string
+	}{
+		{Name: "Path parameter", Template: "{{ .Path.id }}", Want: "42"},
+		{Name: "Query parameter", Template: "{{ .Query.fields }}", Want: "values(Request Number)"},
+		{Name: "Header", Template: "{{ .Headers.Authorization }}", Want: "AR-JWT token"},
+		{Name: "Header helper", Template: `{{ header "authorization" }}`, Want: "AR-JWT token"},
+		{Name: "Body field", Template: `{{ index .Body.values "Login ID" }}`, Want: "admin"},
+		{Name: "JSONPath helper", Template: `{{ jsonPath "$.values['Login ID']" }}`, Want: "admin"},
+		{Name: "JSONPath helper nothing selected", Template: `{{ jsonPath "$.values.missing" }}`, Want: ""},
+		{Name: "Missing value", Template: "{{ .Path.missing }}", Want: ""},
+		{Name: "Missing body field", Template: "Login ID: {{ .Body.missing }}", Want: "Login ID: "},
+		{Name: "Missing nested body field", Template: `{{ index .Body.values "Submitter" }}`, Want: ""},
+		{Name: "Null body field", Template: "{{ .Body.note }}", Want: ""},
+		{Name: "Missing body field in a condition", Template: "{{ if .Body.username }}{{ .Body.username }}{{ else }}{{ .Body.missing }}{{ end }}", Want: "admin"},
+		{Name: "Missing body field with a variable", Template: "{{ $name := .Body.missing }}[{{ $name }}]", Want: "[]"},
+		{Name: "Now helper with layout", Template: `{{ now "2006" }}`, WantLike: `^\d{4}$`},
+		{Name: "UUID helper", Template: "{{ uuid }}", WantLike: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{Name: "Random int helper", Template: "{{ randomInt 5 5 }}", Want: "5"},
+		{Name: "Random string helper", Template: "{{ randomString 8 }}", WantLike: `^[a-zA-Z0-9]{8}$`},
+		{Name: "Counter helper", Template: `{{ counter "render-test" }}-{{ counter "render-test" }}`, Want: "1-2"},
+		{Name: "Not a template", Template: "Approved", Want: "Approved"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			out, err := renderProperties(mocks.Properties{"value": []interface{}{tc.Template}}, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := out["value"].([]interface{})[0].(string)
+			if tc.WantLike != "" {
+				if !regexp.MustCompile(tc.WantLike).MatchString(got) {
+					t.Errorf("rendered wrong value: got %q want like %q", got, tc.WantLike)
+				}
+				return
+			}
+			if got != tc.Want {
+				t.Errorf("rendered wrong value: got %q want %q", got, tc.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Router is the cache of mocks, it matches incoming requests against the endpoint
+// templates of the cached mocks. An endpoint template may contain path parameters
+// such as `/api/arsys/v1/entry/{form}/{id}` which will match any value in that
+// segment of the request path, the captured values are returned with the match.
+// A query string in the endpoint is matched by parameter name against the decoded
+// query of the request, with the path matched on its own
+type Router struct {
+	mu     sync.RWMutex
+	routes []*route
+	seq    int
+}
+
+// Candidate is a cached mock whose endpoint template and verb match a request, with
+// the path parameters captured from the request url
+type Candidate struct {
+	Mock       mocks.Mock
+	PathParams map[string]string
+}
+
+// route is a single cached mock with its endpoint template parsed ready for matching
+type route struct {
+	seq      int
+	verb     string
+	segments []string
+	query    mocks.Query
+	params   int
+	mock     mocks.Mock
+	// assigned is set when the mock was cached without an ID and was assigned one
+	assigned bool
+	// runtime is set when the mock was put at runtime through the api, rather than
+	// loaded from a file or package
+	runtime bool
+}
+
+// NewRouter returns an empty Router
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add adds a mock to the router and returns its ID, a mock without an ID is assigned
+// one. A mock with the same ID as one already cached will replace it, as will a mock
+// without an ID which is the same as a cached mock without an ID, but for its response
+func (rt *Router) Add(mock mocks.Mock) string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	id, _ := rt.add(mock, false)
+	return id
+}
+
+// Put adds a mock put at runtime through the api to the router as Add does, it also
+// reports whether a cached mock was replaced. Mocks put at runtime are those returned
+// by RuntimeMocks
+func (rt *Router) Put(mock mocks.Mock) (string, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.add(mock, true)
+}
+
+// PutAll atomically puts the mocks as Put does, so requests never see some of them
+// without the others. It returns the IDs of the mocks and whether each replaced a mock
+func (rt *Router) PutAll(list []mocks.Mock) ([]string, []bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	ids := make([]string, len(list))
+	replaced := make([]bool, len(list))
+	for i, mock := range list {
+		ids[i], replaced[i] = rt.add(mock, true)
+	}
+	return ids, replaced
+}
+
+// ReplaceRuntime atomically removes the mocks put at runtime and puts the replacements
+// in their place, as when they are restored from a snapshot. The assigned IDs are those of
+// the replacements which were put without an ID, so they are still replaced by a mock put
+// without an ID which expects the same request. It returns the IDs of the replacements
+func (rt *Router) ReplaceRuntime(replacements []mocks.Mock, assigned []string) []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	kept := rt.routes[:0]
+	for _, r := range rt.routes {
+		if !r.runtime {
+			kept = append(kept, r)
+		}
+	}
+	rt.routes = kept
+
+	ids := make([]string, len(replacements))
+	for i, mock := range replacements {
+		ids[i], _ = rt.add(mock, true)
+	}
+	for _, r := range rt.routes {
+		if r.runtime && containsString(assigned, r.mock.ID) {
+			r.assigned = true
+		}
+	}
+	return ids
+}
+
+// AssignedIDs returns the IDs of the mocks put at runtime which were assigned their ID
+func (rt *Router) AssignedIDs() []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	var ids []string
+	for _, r := range rt.routes {
+		if r.runtime && r.assigned {
+			ids = append(ids, r.mock.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Swap atomically removes the cached mocks selected by the remove function and adds the
+// replacements, so requests see either the old set or the new set and never a mix. It
+// returns the IDs of the replacements
+func (rt *Router) Swap(remove func(mocks.Mock) bool, replacements []mocks.Mock) []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	kept := rt.routes[:0]
+	for _, r := range rt.routes {
+		if !remove(r.mock) {
+			kept = append(kept, r)
+		}
+	}
+	rt.routes = kept
+
+	ids := make([]string, len(replacements))
+	for i, mock := range replacements {
+		ids[i], _ = rt.add(mock, false)
+	}
+	return ids
+}
+
+// add adds or replaces a mock, reporting whether a mock was replaced, the lock must be held.
+// A mock without an ID replaces a cached mock which was also added without one, when it
+// expects the same request, so that correcting a mock by loading it again takes effect.
+// The runtime flag records whether the mock was put at runtime
+func (rt *Router) add(mock mocks.Mock, runtime bool) (string, bool) {
+	assigned := mock.ID == ""
+	if assigned {
+		for _, existing := range rt.routes {
+			if existing.assigned && sameRequest(existing.mock, mock) {
+				mock.ID = existing.mock.ID
+				break
+			}
+		}
+	}
+	if mock.ID == "" {
+		mock.ID = newID()
+	}
+
+	rt.seq++
+	r := newRoute(mock, rt.seq)
+	r.assigned = assigned
+	r.runtime = runtime
+
+	for i, existing := range rt.routes {
+		if existing.mock.ID == mock.ID {
+			r.seq = existing.seq
+			r.assigned = existing.assigned
+			rt.routes[i] = r
+			return mock.ID, true
+		}
+	}
+	rt.routes = append(rt.routes, r)
+	return mock.ID, false
+}
+
+// sameRequest reports whether two mocks match the same requests in the same circumstances,
+// they have the same endpoint, verb, priority, scenario state and request expectations
+func sameRequest(a, b mocks.Mock) bool {
+	return a.EndPoint == b.EndPoint &&
+		strings.EqualFold(a.Request.Verb, b.Request.Verb) &&
+		a.Priority == b.Priority &&
+		a.Scenario == b.Scenario &&
+		a.RequiredState == b.RequiredState &&
+		reflect.DeepEqual(a.Request, withVerb(b.Request, a.Request.Verb))
+}
+
+// withVerb returns the request with the verb given, so requests can be compared regardless
+// of the case of their verbs
+func withVerb(req mocks.Request, verb string) mocks.Request {
+	req.Verb = verb
+	return req
+}
+
+// Match finds the cached mocks for the request method and url, they are returned as
+// candidates in the order they should be tried. Candidates are ordered by priority, then
+// those with the fewest path parameters and most query parameters, then in the order added
+func (rt *Router) Match(method string, u *url.URL) []Candidate {
+	reqSegments := splitPath(u.EscapedPath())
+	reqQuery := u.Query()
+	verb := strings.ToUpper(method)
+
+	type match struct {
+		route  *route
+		params map[string]string
+	}
+
+	rt.mu.RLock()
+	var matches []match
+	for _, r := range rt.routes {
+		if r.verb != verb {
+			continue
+		}
+		params, ok := r.matchPath(reqSegments)
+		if !ok || len(matchQuery(r.query, reqQuery)) > 0 {
+			continue
+		}
+		matches = append(matches, match{route: r, params: params})
+	}
+	rt.mu.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].route.before(matches[j].route)
+	})
+
+	candidates := make([]Candidate, len(matches))
+	for i, m := range matches {
+		candidates[i] = Candidate{Mock: m.route.mock, PathParams: m.params}
+	}
+	return candidates
+}
+
+// Len returns the number of mocks in the router
+func (rt *Router) Len() int {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return len(rt.routes)
+}
+
+// Mocks returns the cached mocks in the order they were added
+func (rt *Router) Mocks() []mocks.Mock {
+	return rt.cached(false)
+}
+
+// RuntimeMocks returns the cached mocks which were put at runtime through the api, in the
+// order they were added
+func (rt *Router) RuntimeMocks() []mocks.Mock {
+	return rt.cached(true)
+}
+
+// cached returns the cached mocks in the order they were added, only those put at runtime
+// if runtimeOnly is set
+func (rt *Router) cached(runtimeOnly bool) []mocks.Mock {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	var routes []*route
+	for _, r := range rt.routes {
+		if r.runtime || !runtimeOnly {
+			routes = append(routes, r)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].seq < routes[j].seq })
+
+	list := make([]mocks.Mock, len(routes))
+	for i, r := range routes {
+		list[i] = r.mock
+	}
+	return list
+}
+
+// Get returns the cached mock with the ID
+func (rt *Router) Get(id string) (mocks.Mock, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	for _, r := range rt.routes {
+		if r.mock.ID == id {
+			return r.mock, true
+		}
+	}
+	return mocks.Mock{}, false
+}
+
+// Remove removes the cached mock with the ID, returning it
+func (rt *Router) Remove(id string) (mocks.Mock, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for i, r := range rt.routes {
+		if r.mock.ID == id {
+			rt.routes = append(rt.routes[:i], rt.routes[i+1:]...)
+			return r.mock, true
+		}
+	}
+	return mocks.Mock{}, false
+}
+
+// Reset removes all the cached mocks
+func (rt *Router) Reset() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.routes = nil
+}
+
+// Scenarios returns the names of the scenarios the cached mocks are part of
+func (rt *Router) Scenarios() []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range rt.routes {
+		if name := r.mock.Scenario; name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRoute parses the endpoint template of the mock
+func newRoute(mock mocks.Mock, seq int) *route {
+	path, rawQuery, _ := strings.Cut(mock.EndPoint, "?")
+	r := &route{
+		seq:      seq,
+		verb:     strings.ToUpper(mock.Request.Verb),
+		segments: splitPath(path),
+		mock:     mock,
+	}
+	if query, err := url.ParseQuery(rawQuery); err == nil && len(query) > 0 {
+		r.query.Required = queryFromValues(query)
+	}
+	for _, seg := range r.segments {
+		if _, ok := paramName(seg); ok {
+			r.params++
+		}
+	}
+	return r
+}
+
+// matchPath compares the request path segments with the template, literal segments
+// must be equal and parameter segments capture the request segment
+func (r *route) matchPath(reqSegments []string) (map[string]string, bool) {
+	if len(reqSegments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, seg := range r.segments {
+		if name, ok := paramName(seg); ok {
+			params[name] = reqSegments[i]
+			continue
+		}
+		if seg != reqSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// before reports whether the route should be tried before another which also matches
+func (r *route) before(other *route) bool {
+	if r.mock.Priority != other.mock.Priority {
+		return r.mock.Priority > other.mock.Priority
+	}
+	if r.params != other.params {
+		return r.params < other.params
+	}
+	if len(r.query.Required) != len(other.query.Required) {
+		return len(r.query.Required) > len(other.query.Required)
+	}
+	return r.seq < other.seq
+}
+
+// mockKey describes a mock by its endpoint and verb, `endpoint-verb`
+func mockKey(mock mocks.Mock) string {
+	return mock.EndPoint + "-" + strings.ToUpper(mock.Request.Verb)
+}
+
+// paramName returns the name of a path parameter segment such as `{id}`
+func paramName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+// splitPath splits an escaped path to its unescaped segments, a trailing slash is
+// significant and results in an empty final segment
+func splitPath(path string) []string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if _, ok := paramName(seg); ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	return segments
+}
+
+// newID returns a random (version 4) UUID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
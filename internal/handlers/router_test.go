@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRouterMatch(t *testing.T) {
+	rt := NewRouter()
+	for _, endPoint := range []string{
+		"/api/arsys/v1/entry/{form}/{id}",
+		"/api/arsys/v1/entry/SRM:RequestInterface_Create/{id}",
+		"/api/jwt/login",
+		"/api/search?q=ghost",
+	} {
+		rt.Add(mocks.Mock{
+			EndPoint: endPoint,
+			Request: mocks.Request{
+				Verb: "GET",
+			},
+		})
+	}
+
+	testCases := []struct {
+		Name         string
+		Method       string
+		URL          string
+		WantOK       bool
+		WantEndPoint string
+		WantParams   map[string]string
+	}{
+		{
+			Name:         "Good, literal endpoint",
+			Method:       "GET",
+			URL:          "/api/jwt/login",
+			WantOK:       true,
+			WantEndPoint: "/api/jwt/login",
+			WantParams:   map[string]string{},
+		},
+		{
+			Name:         "Good, path parameters captured",
+			Method:       "GET",
+			URL:          "/api/arsys/v1/entry/HPD:Help%20Desk/000123",
+			WantOK:       true,
+			WantEndPoint: "/api/arsys/v1/entry/{form}/{id}",
+			WantParams:   map[string]string{"form": "HPD:Help Desk", "id": "000123"},
+		},
+		{
+			Name:         "Good, fewest parameters preferred",
+			Method:       "GET",
+			URL:          "/api/arsys/v1/entry/SRM:RequestInterface_Create/42",
+			WantOK:       true,
+			WantEndPoint: "/api/arsys/v1/entry/SRM:RequestInterface_Create/{id}",
+			WantParams:   map[string]string{"id": "42"},
+		},
+		{
+			Name:         "Good, query string in endpoint",
+			Method:       "GET",
+			URL:          "/api/search?q=ghost",
+			WantOK:       true,
+			WantEndPoint: "/api/search?q=ghost",
+			WantParams:   map[string]string{},
+		},
+		{
+			Name:         "Good, query string reordered and encoded differently",
+			Method:       "GET",
+			URL:          "/api/search?page=2&q=%67host",
+			WantOK:       true,
+			WantEndPoint: "/api/search?q=ghost",
+			WantParams:   map[string]string{},
+		},
+		{
+			Name:   "Bad, query string parameter not match",
+			Method: "GET",
+			URL:    "/api/search?q=spook",
+		},
+		{
+			Name:   "Bad, method not match",
+			Method: "POST",
+			URL:    "/api/jwt/login",
+		},
+		{
+			Name:   "Bad, too many segments",
+			Method: "GET",
+			URL:    "/api/arsys/v1/entry/form/id/extra",
+		},
+		{
+			Name:   "Bad, trailing slash",
+			Method: "GET",
+			URL:    "/api/jwt/login/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			u, err := url.Parse(tc.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			candidates := rt.Match(tc.Method, u)
+			if ok := len(candidates) > 0; ok != tc.WantOK {
+				t.Fatalf("match returned wrong result: got %v want %v", ok, tc.WantOK)
+			}
+			if !tc.WantOK {
+				return
+			}
+			if got := candidates[0].Mock.EndPoint; got != tc.WantEndPoint {
+				t.Errorf("matched wrong endpoint: got %v want %v", got, tc.WantEndPoint)
+			}
+			if got := candidates[0].PathParams; !reflect.DeepEqual(got, tc.WantParams) {
+				t.Errorf("captured wrong params: got %v want %v", got, tc.WantParams)
+			}
+		})
+	}
+}
+
+func TestRouterCandidateOrder(t *testing.T) {
+	rt := NewRouter()
+	for _, mock := range []mocks.Mock{
+		{ID: "catch-all", EndPoint: "/api/jwt/login", Priority: -1},
+		{ID: "template", EndPoint: "/api/jwt/{action}"},
+		{ID: "first", EndPoint: "/api/jwt/login"},
+		{ID: "second", EndPoint: "/api/jwt/login"},
+		{ID: "priority", EndPoint: "/api/jwt/login", Priority: 10},
+	} {
+		mock.Request.Verb = "POST"
+		rt.Add(mock)
+	}
+
+	// replacing a mock keeps its place in the order
+	rt.Add(mocks.Mock{ID: "first", EndPoint: "/api/jwt/login", Request: mocks.Request{Verb: "POST"}})
+
+	u, err := url.Parse("/api/jwt/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range rt.Match("POST", u) {
+		got = append(got, c.Mock.ID)
+	}
+
+	want := []string{"priority", "first", "second", "template", "catch-all"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates in wrong order: got %v want %v", got, want)
+	}
+	if rt.Len() != 5 {
+		t.Errorf("router has wrong number of mocks: got %v want %v", rt.Len(), 5)
+	}
+}
+
+func TestRouterSwap(t *testing.T) {
+	rt := NewRouter()
+	for _, mock := range []mocks.Mock{
+		{ID: "posted", EndPoint: "/posted"},
+		{ID: "old-file", EndPoint: "/old", Source: "file:a.yaml"},
+		{ID: "kept-file", EndPoint: "/kept", Source: "file:a.yaml"},
+	} {
+		mock.Request.Verb = "GET"
+		rt.Add(mock)
+	}
+
+	fromFile := func(mock mocks.Mock) bool { return mock.Source == "file:a.yaml" }
+	rt.Swap(fromFile, []mocks.Mock{
+		{ID: "kept-file", EndPoint: "/kept", Source: "file:a.yaml", Request: mocks.Request{Verb: "GET"}},
+		{ID: "new-file", EndPoint: "/new", Source: "file:a.yaml", Request: mocks.Request{Verb: "GET"}},
+	})
+
+	for path, want := range map[string]bool{"/posted": true, "/old": false, "/kept": true, "/new": true} {
+		u, err := url.Parse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(rt.Match("GET", u)) > 0; got != want {
+			t.Errorf("wrong match for %s after swap: got %v want %v", path, got, want)
+		}
+	}
+	if rt.Len() != 3 {
+		t.Errorf("router has wrong number of mocks: got %v want %v", rt.Len(), 3)
+	}
+}
+
+func TestRouterPut(t *testing.T) {
+	rt := NewRouter()
+	login := func(username string, status int) mocks.Mock {
+		return mocks.Mock{
+			EndPoint: "/api/jwt/login",
+			Request:  mocks.Request{Verb: "POST", Body: mocks.Properties{"username": username}},
+			Response: mocks.Response{StatusCode: status},
+		}
+	}
+	withID := login("admin", http.StatusOK)
+	withID.ID = "login"
+
+	testCases := []struct {
+		Name         string
+		Mock         mocks.Mock
+		WantReplaced bool
+		WantLen      int
+	}{
+		{Name: "New mock without an id", Mock: login("admin", http.StatusOK), WantLen: 1},
+		{Name: "Same request replaces it", Mock: login("admin", http.StatusUnauthorized), WantReplaced: true, WantLen: 1},
+		{Name: "Different request is added", Mock: login("demo", http.StatusOK), WantLen: 2},
+		{Name: "Same request with an id is added", Mock: withID, WantLen: 3},
+		{Name: "Same id replaces it", Mock: withID, WantReplaced: true, WantLen: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, replaced := rt.Put(tc.Mock)
+			if replaced != tc.WantReplaced {
+				t.Errorf("wrong replaced: got %v want %v", replaced, tc.WantReplaced)
+			}
+			if rt.Len() != tc.WantLen {
+				t.Errorf("router has wrong number of mocks: got %v want %v", rt.Len(), tc.WantLen)
+			}
+		})
+	}
+
+	// the corrected mock is the one matched
+	u, _ := url.Parse("/api/jwt/login")
+	if got := rt.Match("POST", u)[0].Mock.Response.StatusCode; got != http.StatusUnauthorized {
+		t.Errorf("wrong mock matched: got status %v want %v", got, http.StatusUnauthorized)
+	}
+
+	// mocks put are those added at runtime, unlike mocks added from files and packages
+	rt.Add(mocks.Mock{ID: "packaged", EndPoint: "/packaged", Request: mocks.Request{Verb: "GET"}})
+	if got := len(rt.RuntimeMocks()); got != 3 {
+		t.Errorf("wrong number of runtime mocks: got %v want %v", got, 3)
+	}
+}
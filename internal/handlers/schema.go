@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// schemaCache holds compiled schemas, keyed on the hash of an inline schema or on the
+// path and modification time of a schema file so an edited file is recompiled
+var schemaCache sync.Map
+
+// matchSchema validates the raw request body against the JSON Schema of the mock, if it has
+// one, returning a description of each schema violation. A body which is missing or is not
+// JSON is a violation
+func matchSchema(req mocks.Request, body []byte) []string {
+	if req.Schema == nil && req.SchemaFile == "" {
+		return nil
+	}
+
+	schema, err := loadSchema(req)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid schema (%v)", err)}
+	}
+
+	// numbers are kept as they were sent, so large integers are validated exactly
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return []string{"request body is empty, wanted JSON"}
+		}
+		return []string{fmt.Sprintf("request body is not valid JSON (%v)", err)}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return []string{"request body is not valid JSON (unexpected data after the JSON value)"}
+	}
+
+	err = schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return []string{err.Error()}
+	}
+
+	var failures []string
+	for _, leaf := range leafErrors(ve) {
+		// instance locations are JSON Pointers with the property names url escaped
+		location := leaf.InstanceLocation
+		if unescaped, err := url.PathUnescape(location); err == nil {
+			location = unescaped
+		}
+		if location == "" {
+			location = "/"
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", location, leaf.Message))
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// loadSchema compiles the inline or file based schema of the mock request, draft
+// 2020-12 is assumed where the schema does not declare `$schema`
+func loadSchema(req mocks.Request) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+
+	// a schema file is compiled from its path so relative references resolve
+	var key, schemaURL string
+	if req.SchemaFile != "" {
+		info, err := os.Stat(req.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+		key = fmt.Sprintf("file:%s:%d", req.SchemaFile, info.ModTime().UnixNano())
+		schemaURL = req.SchemaFile
+	} else {
+		source, err := json.Marshal(req.Schema)
+		if err != nil {
+			return nil, err
+		}
+		key = fmt.Sprintf("inline:%x", sha256.Sum256(source))
+		schemaURL = "ghost://inline/schema.json"
+		if err := compiler.AddResource(schemaURL, bytes.NewReader(source)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cached, ok := schemaCache.Load(key); ok {
+		return cached.(*jsonschema.Schema), nil
+	}
+
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaCache.Store(key, schema)
+	return schema, nil
+}
+
+// leafErrors returns the validation errors which have no further causes, these
+// identify the individual violations
+func leafErrors(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range ve.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchSchema(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["values"],
+		"properties": {
+			"values": {
+				"type": "object",
+				"required": ["Login ID", "z1D Action"],
+				"properties": {
+					"Login ID": {"type": "string", "minLength": 1},
+					"z1D Action": {"enum": ["CREATE", "MODIFY"]}
+				}
+			}
+		}
+	}`
+
+	var inline interface{}
+	if err := json.Unmarshal([]byte(schema), &inline); err != nil {
+		t.Fatal(err)
+	}
+
+	schemaFile := filepath.Join(t.TempDir(), "work-order.json")
+	if err := os.WriteFile(schemaFile, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Name         string
+		Body         string
+		WantFailures []string
+	}{
+		{
+			Name: "Good, body validates",
+			Body: `{"values": {"Login ID": "admin", "z1D Action": "CREATE"}}`,
+		},
+		{
+			Name: "Bad, each violation reported",
+			Body: `{"values": {"Login ID": "", "z1D Action": "DELETE"}}`,
+			WantFailures: []string{
+				`/values/Login ID: length must be >= 1, but got 0`,
+				`/values/z1D Action: value must be one of "CREATE", "MODIFY"`,
+			},
+		},
+		{
+			Name:         "Bad, required property missing",
+			Body:         `{}`,
+			WantFailures: []string{`/: missing properties: 'values'`},
+		},
+		{
+			Name:         "Bad, top level array validated",
+			Body:         `[{"values": {}}]`,
+			WantFailures: []string{`/: expected object, but got array`},
+		},
+		{
+			Name:         "Bad, null body not treated as an object",
+			Body:         `null`,
+			WantFailures: []string{`/: expected object, but got null`},
+		},
+		{
+			Name:         "Bad, empty body",
+			Body:         ``,
+			WantFailures: []string{`request body is empty, wanted JSON`},
+		},
+		{
+			Name:         "Bad, body not json",
+			Body:         `values=1`,
+			WantFailures: []string{`request body is not valid JSON (invalid character 'v' looking for beginning of value)`},
+		},
+		{
+			Name:         "Bad, data after the json",
+			Body:         `{"values": {"Login ID": "admin", "z1D Action": "CREATE"}} {}`,
+			WantFailures: []string{`request body is not valid JSON (unexpected data after the JSON value)`},
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, req := range []mocks.Request{{Schema: inline}, {SchemaFile: schemaFile}} {
+			t.Run(tc.Name, func(t *testing.T) {
+				failures := matchSchema(req, []byte(tc.Body))
+				if !reflect.DeepEqual(failures, tc.WantFailures) {
+					t.Errorf("wrong failures: got %q want %q", failures, tc.WantFailures)
+				}
+			})
+		}
+	}
+}
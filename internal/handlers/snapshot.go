@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/loader"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"os"
+	"sync"
+)
+
+// Snapshot is the runtime state of the server, the mocks put at runtime through the api, the
+// state of each scenario, the template counters and the number of calls matched by each mock.
+// Mocks from files and packages are not part of the snapshot as they are loaded from their
+// source. AssignedIDs are the IDs of the mocks which were put without one
+type Snapshot struct {
+	Mocks       []mocks.Mock      `json:"mocks"`
+	AssignedIDs []string          `json:"assignedIds,omitempty"`
+	Scenarios   map[string]string `json:"scenarios"`
+	Counters    map[string]int    `json:"counters"`
+	MockCalls   map[string]int    `json:"mockCalls"`
+}
+
+// TakeSnapshot returns a snapshot of the current runtime state
+func TakeSnapshot() Snapshot {
+	return Snapshot{
+		Mocks:       MocksCache.RuntimeMocks(),
+		AssignedIDs: MocksCache.AssignedIDs(),
+		Scenarios:   State.Scenarios(),
+		Counters:    State.Counters(),
+		MockCalls:   State.Calls(),
+	}
+}
+
+// RestoreSnapshot restores the runtime state from a snapshot, it returns the number of mocks
+// restored. The mocks in the snapshot replace any mocks put at runtime in the cache. The
+// calls matched by each mock are restored by mock ID, so a mock in a file or package without
+// an ID, which is assigned a new one each time it is loaded, starts its sequence again
+func RestoreSnapshot(snap Snapshot) int {
+	restored := MocksCache.ReplaceRuntime(snap.Mocks, snap.AssignedIDs)
+	State.Restore(snap.Counters, snap.Scenarios, snap.MockCalls)
+	return len(restored)
+}
+
+// StateFile is the file snapshots are saved to and restored from
+type StateFile struct {
+	Path string
+
+	mu    sync.Mutex
+	saved []byte
+}
+
+// NewStateFile returns the state file at the path
+func NewStateFile(path string) *StateFile {
+	return &StateFile{Path: path}
+}
+
+// Save writes the snapshot to the file, unless it is unchanged since the last save. It
+// reports whether the file was written
+func (f *StateFile) Save(snap Snapshot) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, f.saved) {
+		return false, nil
+	}
+	if err := loader.WriteFile(f.Path, data); err != nil {
+		return false, err
+	}
+	f.saved = data
+	return true, nil
+}
+
+// Load reads the snapshot in the file, the error satisfies os.IsNotExist when there is no file
+func (f *StateFile) Load() (Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var snap Snapshot
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("state file '%s' is not a snapshot (%v)", f.Path, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	defer func(state *StateStore) { State = state }(State)
+
+	// the mocks loaded at startup, from packages and a file, a package may set its own source
+	startup := func() {
+		MocksCache = NewRouter()
+		State = NewStateStore()
+		MocksCache.Add(mocks.Mock{ID: "login", Source: SourcePackage + "Remedy", EndPoint: "/api/jwt/login", Request: mocks.Request{Verb: "POST"}})
+		MocksCache.Add(mocks.Mock{ID: "status", Source: "file:mocks/status.yaml", EndPoint: "/status", Request: mocks.Request{Verb: "GET"}})
+		MocksCache.Add(mocks.Mock{ID: "health", Source: "vendor", EndPoint: "/health", Request: mocks.Request{Verb: "GET"}})
+	}
+	startup()
+
+	app := &App{
+		Logger:    &koan.Logger{},
+		StateFile: NewStateFile(filepath.Join(t.TempDir(), "state", "ghost.json")),
+	}
+
+	// mocks and state added at runtime
+	for _, body := range []string{
+		`{"id": "entry", "endPoint": "/entry/{id}", "request": {"verb": "GET"}, "response": {"status": 200}}`,
+		`{"id": "approval", "scenario": "approval", "newState": "Approved", "endPoint": "/approve", "request": {"verb": "POST"}, "response": {"status": 204}}`,
+	} {
+		if rr := doRequest(t, app.MockLoader, "POST", "/load/mock", []byte(body)); rr.Code != http.StatusCreated {
+			t.Fatalf("could not load mock: %s", rr.Body.String())
+		}
+	}
+	put := `{"endPoint": "/orders", "request": {"verb": "GET"}, "response": {"status": 200}}`
+	if rr := doRequest(t, app.Admin, "PUT", "/__admin/mocks/orders", []byte(put)); rr.Code != http.StatusCreated {
+		t.Fatalf("could not put mock: %s", rr.Body.String())
+	}
+	doRequest(t, app.Handler, "GET", "/entry/1", nil)
+	doRequest(t, app.Handler, "POST", "/approve", nil)
+	State.Increment("orders")
+
+	rr := doRequest(t, app.Admin, "POST", "/__admin/snapshot", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var res Snapshot
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// only the mocks put at runtime are in the snapshot
+	if len(res.Mocks) != 3 {
+		t.Errorf("wrong number of mocks in snapshot: got %v want %v", len(res.Mocks), 3)
+	}
+	if _, err := os.Stat(app.StateFile.Path); err != nil {
+		t.Fatalf("state file not saved: %v", err)
+	}
+	if saved, err := app.StateFile.Save(TakeSnapshot()); saved || err != nil {
+		t.Errorf("unchanged snapshot should not be saved again: got %v %v", saved, err)
+	}
+
+	// restart, restoring from the state file
+	startup()
+	snap, err := NewStateFile(app.StateFile.Path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := RestoreSnapshot(snap); n != 3 {
+		t.Errorf("wrong number of mocks restored: got %v want %v", n, 3)
+	}
+
+	var ids []string
+	for _, mock := range MocksCache.Mocks() {
+		ids = append(ids, mock.ID)
+	}
+	testCases := []struct {
+		Name string
+		Got  interface{}
+		Want interface{}
+	}{
+		{Name: "Runtime mocks restored beside startup mocks", Got: ids, Want: []string{"login", "status", "health", "entry", "approval", "orders"}},
+		{Name: "Scenario state", Got: State.ScenarioState("approval"), Want: "Approved"},
+		{Name: "Counters", Got: State.Counters(), Want: map[string]int{"orders": 1}},
+		{Name: "Mock calls", Got: State.Calls(), Want: map[string]int{"entry": 1, "approval": 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.Got, tc.Want) {
+				t.Errorf("wrong restored state: got %v want %v", tc.Got, tc.Want)
+			}
+		})
+	}
+
+	// a missing state file is reported as not existing
+	if _, err := NewStateFile(filepath.Join(t.TempDir(), "missing.json")).Load(); !os.IsNotExist(err) {
+		t.Errorf("wrong error for missing state file: got %v", err)
+	}
+
+	rr = doRequest(t, app.Admin, "GET", "/__admin/snapshot", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestSnapshotAssignedIDs(t *testing.T) {
+	defer func(cache *Router) { MocksCache = cache }(MocksCache)
+	defer func(state *StateStore) { State = state }(State)
+	MocksCache = NewRouter()
+	State = NewStateStore()
+
+	status := func(code int) mocks.Mock {
+		return mocks.Mock{EndPoint: "/status", Request: mocks.Request{Verb: "GET"}, Response: mocks.Response{StatusCode: code}}
+	}
+	id, _ := MocksCache.Put(status(http.StatusOK))
+
+	// restart, restoring from a snapshot which has been saved as json
+	data, err := json.Marshal(TakeSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatal(err)
+	}
+	MocksCache = NewRouter()
+	RestoreSnapshot(snap)
+
+	// a corrected mock put without an id still replaces the restored mock
+	got, replaced := MocksCache.Put(status(http.StatusAccepted))
+	if !replaced || got != id || MocksCache.Len() != 1 {
+		t.Errorf("restored mock not replaced: got %v %v with %d mocks", got, replaced, MocksCache.Len())
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"sync"
+)
+
+// ScenarioStarted is the state every scenario begins in
+const ScenarioStarted = "Started"
+
+var (
+	// errSequenceExhausted is returned by Claim when a fall through sequence is used up
+	errSequenceExhausted = errors.New("response sequence is exhausted")
+	// errScenarioChanged is returned by Claim when the scenario has left the required state
+	errScenarioChanged = errors.New("scenario changed state")
+)
+
+// StateStore holds the runtime state shared across requests, such as the named
+// counters used by response templates, the current state of each scenario and
+// the number of calls matched by each mock
+type StateStore struct {
+	mu        sync.Mutex
+	counters  map[string]int
+	scenarios map[string]string
+	calls     map[string]int
+}
+
+// State is the runtime state of the server
+var State = NewStateStore()
+
+// NewStateStore returns an empty StateStore
+func NewStateStore() *StateStore {
+	return &StateStore{
+		counters:  map[string]int{},
+		scenarios: map[string]string{},
+		calls:     map[string]int{},
+	}
+}
+
+// Increment increments the named counter and returns its new value, counters start at zero
+func (s *StateStore) Increment(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[name]++
+	return s.counters[name]
+}
+
+// Counters returns a copy of the current counter values
+func (s *StateStore) Counters() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int, len(s.counters))
+	for k, v := range s.counters {
+		out[k] = v
+	}
+	return out
+}
+
+// ResetCounters sets all counters, including the mock call counters, back to zero
+func (s *StateStore) ResetCounters() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters = map[string]int{}
+	s.calls = map[string]int{}
+}
+
+// Claim claims a call matched by the mock and returns the response to send. For a mock with
+// a sequence of responses this is the next in the sequence, once the sequence is used up the
+// last response is repeated, or the sequence cycles back to the first, or errSequenceExhausted
+// is returned so the request falls through to the next candidate mock. The scenario of the
+// mock moves to its new state, unless it is no longer in the state the mock requires when
+// errScenarioChanged is returned. The call is recorded and the transition made together, or
+// neither is, so a request which loses a race for the transition uses no sequence position.
+// The release function gives the claim back when the response is never sent, as when the
+// client goes away during the delay
+func (s *StateStore) Claim(mock mocks.Mock) (mocks.Response, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mock.Scenario != "" && mock.RequiredState != "" && s.scenarioState(mock.Scenario) != mock.RequiredState {
+		return mocks.Response{}, nil, errScenarioChanged
+	}
+
+	n := s.calls[mock.ID]
+	response := mock.Response
+	if len(mock.Responses) > 0 {
+		i := n
+		if n >= len(mock.Responses) {
+			switch mock.SequenceMode {
+			case mocks.SequenceCycle:
+				i = n % len(mock.Responses)
+			case mocks.SequenceFallThrough:
+				return mocks.Response{}, nil, errSequenceExhausted
+			default:
+				i = len(mock.Responses) - 1
+			}
+		}
+		response = mock.Responses[i]
+	}
+
+	s.calls[mock.ID]++
+	previous, set := s.scenarios[mock.Scenario]
+	if mock.Scenario != "" && mock.NewState != "" {
+		s.scenarios[mock.Scenario] = mock.NewState
+	}
+	return response, func() { s.release(mock, previous, !set) }, nil
+}
+
+// release gives back a call claimed by the mock, the call is no longer counted and the
+// scenario returns to its previous state, unless it has moved on since the claim. Started
+// is set when the scenario was in the started state
+func (s *StateStore) release(mock mocks.Mock, previous string, started bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.calls[mock.ID] > 0 {
+		s.calls[mock.ID]--
+	}
+	if mock.Scenario == "" || mock.NewState == "" || s.scenarioState(mock.Scenario) != mock.NewState {
+		return
+	}
+	if started {
+		delete(s.scenarios, mock.Scenario)
+		return
+	}
+	s.scenarios[mock.Scenario] = previous
+}
+
+// Calls returns a copy of the number of calls matched by each mock, keyed on mock ID
+func (s *StateStore) Calls() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int, len(s.calls))
+	for k, v := range s.calls {
+		out[k] = v
+	}
+	return out
+}
+
+// ScenarioState returns the current state of the named scenario
+func (s *StateStore) ScenarioState(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenarioState(name)
+}
+
+func (s *StateStore) scenarioState(name string) string {
+	if state, ok := s.scenarios[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// SetScenarioState sets the state of the named scenario
+func (s *StateStore) SetScenarioState(name, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios[name] = state
+}
+
+// Scenarios returns a copy of the scenario states which have been set
+func (s *StateStore) Scenarios() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.scenarios))
+	for k, v := range s.scenarios {
+		out[k] = v
+	}
+	return out
+}
+
+// Restore replaces the counters, scenario states and mock call counters, as when the
+// server is restored from a snapshot
+func (s *StateStore) Restore(counters map[string]int, scenarios map[string]string, calls map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters = map[string]int{}
+	for k, v := range counters {
+		s.counters[k] = v
+	}
+	s.scenarios = map[string]string{}
+	for k, v := range scenarios {
+		s.scenarios[k] = v
+	}
+	s.calls = map[string]int{}
+	for k, v := range calls {
+		s.calls[k] = v
+	}
+}
+
+// ResetScenario returns the named scenario to the started state
+func (s *StateStore) ResetScenario(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scenarios, name)
+}
+
+// ResetScenarios returns all scenarios to the started state
+func (s *StateStore) ResetScenarios() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = map[string]string{}
+}
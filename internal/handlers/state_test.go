@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"testing"
+)
+
+func TestStateStoreClaim(t *testing.T) {
+	sequence := []mocks.Response{
+		{StatusCode: http.StatusAccepted},
+		{StatusCode: http.StatusOK},
+	}
+
+	testCases := []struct {
+		Name          string
+		Mock          mocks.Mock
+		Scenarios     map[string]string
+		WantStatuses  []int
+		WantErr       error
+		WantCalls     int
+		WantScenarios map[string]string
+	}{
+		{
+			Name:         "Single response repeated",
+			Mock:         mocks.Mock{ID: "single", Response: mocks.Response{StatusCode: http.StatusOK}},
+			WantStatuses: []int{http.StatusOK, http.StatusOK},
+			WantCalls:    2,
+		},
+		{
+			Name:         "Sequence sticks on the last response",
+			Mock:         mocks.Mock{ID: "stick", Responses: sequence},
+			WantStatuses: []int{http.StatusAccepted, http.StatusOK, http.StatusOK},
+			WantCalls:    3,
+		},
+		{
+			Name:         "Sequence cycles",
+			Mock:         mocks.Mock{ID: "cycle", Responses: sequence, SequenceMode: mocks.SequenceCycle},
+			WantStatuses: []int{http.StatusAccepted, http.StatusOK, http.StatusAccepted},
+			WantCalls:    3,
+		},
+		{
+			Name:         "Sequence falls through once used up",
+			Mock:         mocks.Mock{ID: "fall", Responses: sequence, SequenceMode: mocks.SequenceFallThrough},
+			WantStatuses: []int{http.StatusAccepted, http.StatusOK},
+			WantErr:      errSequenceExhausted,
+			WantCalls:    2,
+		},
+		{
+			Name: "Scenario moved to its new state",
+			Mock: mocks.Mock{ID: "approve", Responses: sequence, Scenario: "approval",
+				RequiredState: ScenarioStarted, NewState: "Approved"},
+			WantStatuses:  []int{http.StatusAccepted},
+			WantErr:       errScenarioChanged,
+			WantCalls:     1,
+			WantScenarios: map[string]string{"approval": "Approved"},
+		},
+		{
+			Name: "Scenario in another state, no sequence position used",
+			Mock: mocks.Mock{ID: "lost-race", Responses: sequence, Scenario: "approval",
+				RequiredState: ScenarioStarted, NewState: "Approved"},
+			Scenarios:     map[string]string{"approval": "Rejected"},
+			WantErr:       errScenarioChanged,
+			WantScenarios: map[string]string{"approval": "Rejected"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			state := NewStateStore()
+			state.Restore(nil, tc.Scenarios, nil)
+
+			// claim each wanted response, then once more for the wanted error
+			for i, want := range tc.WantStatuses {
+				response, _, err := state.Claim(tc.Mock)
+				if err != nil {
+					t.Fatalf("claim %d: unexpected error %v", i+1, err)
+				}
+				if response.StatusCode != want {
+					t.Errorf("claim %d: wrong status: got %d want %d", i+1, response.StatusCode, want)
+				}
+			}
+			if tc.WantErr != nil {
+				if _, _, err := state.Claim(tc.Mock); err != tc.WantErr {
+					t.Errorf("wrong error: got %v want %v", err, tc.WantErr)
+				}
+			}
+
+			if got := state.Calls()[tc.Mock.ID]; got != tc.WantCalls {
+				t.Errorf("wrong calls: got %d want %d", got, tc.WantCalls)
+			}
+			for name, want := range tc.WantScenarios {
+				if got := state.ScenarioState(name); got != want {
+					t.Errorf("wrong state for scenario '%s': got %s want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
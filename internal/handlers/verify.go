@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestPattern describes the requests to look for in the journal, the endpoint template
+// and request expectations are matched as they are for a mock. A pattern without a verb
+// matches requests with any method
+type RequestPattern struct {
+	EndPoint string        `json:"endPoint"`
+	Request  mocks.Request `json:"request"`
+}
+
+// VerifyRequest is the body of a verification, the number of journal requests matching the
+// pattern is checked against the Exactly, AtLeast and AtMost expectations given. InOrder
+// checks that requests matching each pattern in turn were received in that order
+type VerifyRequest struct {
+	RequestPattern
+	Exactly *int             `json:"exactly,omitempty"`
+	AtLeast *int             `json:"atLeast,omitempty"`
+	AtMost  *int             `json:"atMost,omitempty"`
+	InOrder []RequestPattern `json:"inOrder,omitempty"`
+}
+
+// VerifyResponse is the result of a verification, Passed is true when every expectation
+// is met, otherwise the Failures describe those which were not
+type VerifyResponse struct {
+	Passed   bool           `json:"passed"`
+	Count    int            `json:"count"`
+	InOrder  *bool          `json:"inOrder,omitempty"`
+	Failures []string       `json:"failures,omitempty"`
+	Requests []JournalEntry `json:"requests"`
+}
+
+// verify checks the journal against the expectations of the verification
+func verify(v VerifyRequest, entries []JournalEntry) VerifyResponse {
+	res := VerifyResponse{Requests: []JournalEntry{}}
+
+	if v.EndPoint != "" {
+		unchecked := 0
+		for _, e := range entries {
+			matched, truncated := matchEntry(v.RequestPattern, e)
+			if matched {
+				res.Requests = append(res.Requests, e)
+			}
+			if truncated {
+				unchecked++
+			}
+		}
+		res.Count = len(res.Requests)
+
+		if unchecked > 0 {
+			res.Failures = append(res.Failures, truncatedFailure(unchecked))
+		}
+
+		if v.Exactly != nil && res.Count != *v.Exactly {
+			res.Failures = append(res.Failures, fmt.Sprintf("wanted exactly %d requests, got %d", *v.Exactly, res.Count))
+		}
+		if v.AtLeast != nil && res.Count < *v.AtLeast {
+			res.Failures = append(res.Failures, fmt.Sprintf("wanted at least %d requests, got %d", *v.AtLeast, res.Count))
+		}
+		if v.AtMost != nil && res.Count > *v.AtMost {
+			res.Failures = append(res.Failures, fmt.Sprintf("wanted at most %d requests, got %d", *v.AtMost, res.Count))
+		}
+	}
+
+	if len(v.InOrder) > 0 {
+		inOrder, failure := matchOrder(v.InOrder, entries)
+		res.InOrder = &inOrder
+		if !inOrder {
+			res.Failures = append(res.Failures, failure)
+		}
+	}
+
+	res.Passed = len(res.Failures) == 0
+	return res
+}
+
+// matchOrder reports whether requests matching each of the patterns were received in
+// order, other requests may come between them. On failure it describes the first pattern
+// which had no matching request after those before it
+func matchOrder(patterns []RequestPattern, entries []JournalEntry) (bool, string) {
+	next := 0
+	for i, p := range patterns {
+		found := false
+		unchecked := 0
+		for next < len(entries) {
+			e := entries[next]
+			next++
+			matched, truncated := matchEntry(p, e)
+			if truncated {
+				unchecked++
+			}
+			if matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failure := fmt.Sprintf("no request matched %s", describePattern(p))
+			if i > 0 {
+				failure += fmt.Sprintf(" after %s", describePattern(patterns[i-1]))
+			}
+			if unchecked > 0 {
+				failure += ", " + truncatedFailure(unchecked)
+			}
+			return false, failure
+		}
+	}
+	return true, ""
+}
+
+// matchEntry reports whether a journal request matches the pattern. A request whose body
+// was truncated in the journal cannot be checked against the body expectations of the
+// pattern, it does not match and truncated is true when it matches otherwise
+func matchEntry(p RequestPattern, e JournalEntry) (matched, truncated bool) {
+	if p.Request.Verb != "" && !strings.EqualFold(p.Request.Verb, e.Method) {
+		return false, false
+	}
+
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return false, false
+	}
+
+	mock := mocks.Mock{EndPoint: p.EndPoint, Request: p.Request}
+	r := newRoute(mock, 0)
+	params, ok := r.matchPath(splitPath(u.EscapedPath()))
+	if !ok || len(matchQuery(r.query, u.Query())) > 0 {
+		return false, false
+	}
+
+	req, err := http.NewRequest(e.Method, e.URL, strings.NewReader(e.Body))
+	if err != nil {
+		return false, false
+	}
+	req.Header = e.Headers
+
+	if e.BodyTruncated && hasBodyExpectations(p.Request) {
+		mock.Request.Body, mock.Request.BodyAssertions = nil, nil
+		mock.Request.Schema, mock.Request.SchemaFile = nil, ""
+		return false, checkRequest(Candidate{Mock: mock, PathParams: params}, req, nil, mocks.Properties{}) == ""
+	}
+
+	reqBody, _ := parseRequestBody(e.Headers.Get("Content-Type"), []byte(e.Body))
+	return checkRequest(Candidate{Mock: mock, PathParams: params}, req, []byte(e.Body), reqBody) == "", false
+}
+
+// hasBodyExpectations reports whether the request expectations check the body
+func hasBodyExpectations(req mocks.Request) bool {
+	return len(req.Body) > 0 || len(req.BodyAssertions) > 0 || req.Schema != nil || req.SchemaFile != ""
+}
+
+// truncatedFailure describes the requests which could not be checked as their bodies
+// were truncated in the journal
+func truncatedFailure(n int) string {
+	return fmt.Sprintf("%d requests had bodies over the journal limit of %d bytes which could not be checked", n, journalBodyLimit)
+}
+
+// describePattern describes a pattern by its verb and endpoint
+func describePattern(p RequestPattern) string {
+	verb := strings.ToUpper(p.Request.Verb)
+	if verb == "" {
+		verb = "ANY"
+	}
+	return fmt.Sprintf("'%s %s'", verb, p.EndPoint)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"github.com/spoonboy-io/koan"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	app := &App{
+		Logger: &koan.Logger{},
+	}
+	defer func(journal *RequestJournal) { Journal = journal }(Journal)
+	Journal = NewRequestJournal(100)
+
+	for _, mock := range []mocks.Mock{
+		{ID: "verify-login", EndPoint: "/verify/jwt/login", Request: mocks.Request{Verb: "POST"}, Response: mocks.Response{StatusCode: http.StatusOK, RawBody: "token"}},
+		{ID: "verify-logout", EndPoint: "/verify/jwt/logout", Request: mocks.Request{Verb: "POST"}, Response: mocks.Response{StatusCode: http.StatusNoContent}},
+		{ID: "verify-entry", EndPoint: "/verify/entry/{form}", Request: mocks.Request{Verb: "POST"}, Response: mocks.Response{StatusCode: http.StatusCreated}},
+		{ID: "verify-upload", EndPoint: "/verify/upload", Request: mocks.Request{Verb: "POST"}, Response: mocks.Response{StatusCode: http.StatusCreated}},
+	} {
+		MocksCache.Add(mock)
+	}
+
+	doRequest(t, app.Handler, "POST", "/verify/jwt/login", []byte(`{"username": "Demo", "password": "secret"}`))
+	doRequest(t, app.Handler, "POST", "/verify/entry/HPD:Help%20Desk", []byte(`{"values": {"Status": "New"}}`))
+	doRequest(t, app.Handler, "POST", "/verify/entry/WOI:WorkOrder", []byte(`{"values": {"Status": "Assigned"}}`))
+	doRequest(t, app.Handler, "POST", "/verify/jwt/logout", nil)
+	doRequest(t, app.Handler, "POST", "/verify/upload", []byte(`{"name": "large", "data": "`+strings.Repeat("x", journalBodyLimit)+`"}`))
+
+	testCases := []struct {
+		Name        string
+		Body        string
+		WantStatus  int
+		WantPassed  bool
+		WantCount   int
+		WantInOrder *bool
+		WantFailure string
+	}{
+		{
+			Name:       "Logout exactly once",
+			Body:       `{"endPoint": "/verify/jwt/logout", "request": {"verb": "POST"}, "exactly": 1}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 1,
+		},
+		{
+			Name:       "Logout exactly once after login",
+			Body:       `{"endPoint": "/verify/jwt/logout", "request": {"verb": "POST"}, "exactly": 1, "inOrder": [{"endPoint": "/verify/jwt/login"}, {"endPoint": "/verify/jwt/logout"}]}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 1, WantInOrder: boolPtr(true),
+		},
+		{
+			Name:       "Login after logout",
+			Body:       `{"inOrder": [{"endPoint": "/verify/jwt/logout"}, {"endPoint": "/verify/jwt/login"}]}`,
+			WantStatus: http.StatusOK, WantPassed: false, WantInOrder: boolPtr(false),
+		},
+		{
+			Name:       "Template with body operators",
+			Body:       `{"endPoint": "/verify/entry/{form}", "request": {"verb": "POST", "body": {"values": {"Status": {"$oneOf": ["New", "Assigned"]}}}}, "atLeast": 2, "atMost": 2}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 2,
+		},
+		{
+			Name:       "Path parameter expectation",
+			Body:       `{"endPoint": "/verify/entry/{form}", "request": {"pathParams": {"form": "HPD:Help Desk"}}, "exactly": 1}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 1,
+		},
+		{
+			Name:       "Body",
+			Body:       `{"endPoint": "/verify/jwt/login", "request": {"verb": "POST", "body": {"username": "Demo"}}, "exactly": 1}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 1,
+		},
+		{
+			Name:       "Body over the journal limit not checked",
+			Body:       `{"endPoint": "/verify/upload", "request": {"verb": "POST", "body": {"name": "large"}}, "exactly": 1}`,
+			WantStatus: http.StatusOK, WantPassed: false, WantCount: 0,
+			WantFailure: "1 requests had bodies over the journal limit",
+		},
+		{
+			Name:       "Body over the journal limit not checked in order",
+			Body:       `{"inOrder": [{"endPoint": "/verify/jwt/logout"}, {"endPoint": "/verify/upload", "request": {"body": {"name": "large"}}}]}`,
+			WantStatus: http.StatusOK, WantPassed: false, WantInOrder: boolPtr(false),
+			WantFailure: "1 requests had bodies over the journal limit",
+		},
+		{
+			Name:       "Body over the journal limit without body expectations",
+			Body:       `{"endPoint": "/verify/upload", "request": {"verb": "POST"}, "exactly": 1}`,
+			WantStatus: http.StatusOK, WantPassed: true, WantCount: 1,
+		},
+		{
+			Name:       "Too few",
+			Body:       `{"endPoint": "/verify/jwt/login", "atLeast": 2}`,
+			WantStatus: http.StatusOK, WantPassed: false, WantCount: 1,
+		},
+		{
+			Name:       "Too many",
+			Body:       `{"endPoint": "/verify/entry/{form}", "atMost": 1}`,
+			WantStatus: http.StatusOK, WantPassed: false, WantCount: 2,
+		},
+		{
+			Name:       "No pattern",
+			Body:       `{"exactly": 1}`,
+			WantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := doRequest(t, app.Admin, "POST", "/__admin/requests/verify", []byte(tc.Body))
+			if rr.Code != tc.WantStatus {
+				t.Fatalf("wrong status code: got %v want %v (%s)", rr.Code, tc.WantStatus, rr.Body.String())
+			}
+			if tc.WantStatus != http.StatusOK {
+				return
+			}
+			var res VerifyResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Passed != tc.WantPassed || res.Count != tc.WantCount {
+				t.Errorf("wrong verification: got passed %v count %v want passed %v count %v (%v)", res.Passed, res.Count, tc.WantPassed, tc.WantCount, res.Failures)
+			}
+			if (res.InOrder == nil) != (tc.WantInOrder == nil) || (res.InOrder != nil && *res.InOrder != *tc.WantInOrder) {
+				t.Errorf("wrong order result: got %v want %v", res.InOrder, tc.WantInOrder)
+			}
+			if !res.Passed && len(res.Failures) == 0 {
+				t.Error("wanted failures for a failed verification")
+			}
+			if tc.WantFailure != "" && !strings.Contains(strings.Join(res.Failures, "; "), tc.WantFailure) {
+				t.Errorf("wrong failures: got %q want one like %q", res.Failures, tc.WantFailure)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
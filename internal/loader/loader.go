@@ -0,0 +1,432 @@
+// Package loader reads mock definitions from YAML and JSON files
+package loader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Error is a problem with the mocks in a file, Line is the line of the mock or field
+// at fault, it is 0 when the problem is not with a particular line
+type Error struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Error implements the error interface, errors are formatted `file:line: message`
+func (e Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// sourcePrefix begins the source of a mock loaded from a file, it is followed by the path
+const sourcePrefix = "file:"
+
+// FromFile reports whether the mock was loaded from a file
+func FromFile(mock mocks.Mock) bool {
+	return strings.HasPrefix(mock.Source, sourcePrefix)
+}
+
+// extensions are the file extensions of mock files found in directories
+var extensions = []string{".yaml", ".yml", ".json"}
+
+// Files expands files, glob patterns and directories to the mock files they name, the
+// files in a directory (and its subdirectories) with a YAML or JSON extension are included
+func Files(paths []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern '%s' (%v)", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no mock files found for '%s'", p)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			var found []string
+			err = filepath.WalkDir(match, func(file string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && isMockFile(file) {
+					found = append(found, file)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(found)
+			for _, file := range found {
+				add(file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// Load reads the mocks from each of the files, the valid mocks are returned along with
+// the errors found in every file
+func Load(files []string) ([]mocks.Mock, []error) {
+	var all []mocks.Mock
+	var errs []error
+	for _, file := range files {
+		loaded, fileErrs := LoadFile(file)
+		all = append(all, loaded...)
+		errs = append(errs, fileErrs...)
+	}
+	return all, errs
+}
+
+// LoadFile reads the mocks in a YAML or JSON file. The file may hold a single mock, a list
+// of mocks, or an object with a `mocks` list, and a YAML file may hold several documents.
+// Mocks which cannot be decoded or fail validation are not returned, there is an error for
+// each problem with the line number of the field at fault. The source of each mock is the file
+func LoadFile(file string) ([]mocks.Mock, []error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, []error{Error{File: file, Message: err.Error()}}
+	}
+	defer f.Close()
+
+	var loaded []mocks.Mock
+	var errs []error
+
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			line, msg := syntaxError(err)
+			return nil, []error{Error{File: file, Line: line, Message: msg}}
+		}
+
+		nodes, err := mockNodes(&doc)
+		if err != nil {
+			return nil, []error{Error{File: file, Line: doc.Line, Message: err.Error()}}
+		}
+
+		for _, node := range nodes {
+			mock, mockErrs := decodeMock(node)
+			if len(mockErrs) > 0 {
+				for _, e := range mockErrs {
+					e.File = file
+					errs = append(errs, e)
+				}
+				continue
+			}
+			mock.Source = sourcePrefix + file
+			loaded = append(loaded, resolvePaths(mock, filepath.Dir(file)))
+		}
+	}
+	return loaded, errs
+}
+
+// resolvePaths resolves the relative paths of the files a mock refers to, its body and schema
+// files, against the directory of the mock file rather than the working directory
+func resolvePaths(mock mocks.Mock, dir string) mocks.Mock {
+	inDir := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	mock.Request.SchemaFile = inDir(mock.Request.SchemaFile)
+	mock.Response.BodyFile = inDir(mock.Response.BodyFile)
+	if len(mock.Responses) > 0 {
+		responses := make([]mocks.Response, len(mock.Responses))
+		for i, response := range mock.Responses {
+			response.BodyFile = inDir(response.BodyFile)
+			responses[i] = response
+		}
+		mock.Responses = responses
+	}
+	return mock
+}
+
+// mockNodes finds the nodes of the mocks in a document
+func mockNodes(doc *yaml.Node) ([]*yaml.Node, error) {
+	root := resolve(doc)
+	if root == nil {
+		return nil, nil
+	}
+
+	switch root.Kind {
+	case yaml.SequenceNode:
+		return root.Content, nil
+	case yaml.MappingNode:
+		if list := mappingValue(root, "mocks"); list != nil {
+			if list.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("mocks should be a list")
+			}
+			return list.Content, nil
+		}
+		return []*yaml.Node{root}, nil
+	}
+	return nil, fmt.Errorf("should hold a mock, a list of mocks or an object with a 'mocks' list")
+}
+
+// decodeMock decodes and validates a mock, the errors have the line at fault
+func decodeMock(node *yaml.Node) (mocks.Mock, []Error) {
+	node = resolve(node)
+	mock := mocks.Mock{}
+	if node.Kind != yaml.MappingNode {
+		return mock, []Error{{Line: node.Line, Message: "mock should be an object"}}
+	}
+
+	if errs := unknownFields(node, reflect.TypeOf(mock), ""); len(errs) > 0 {
+		return mock, errs
+	}
+
+	// a mock is decoded via json so that the json field names and types apply
+	raw, err := json.Marshal(toValue(node))
+	if err == nil {
+		err = json.Unmarshal(raw, &mock)
+	}
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return mock, []Error{{
+				Line:    fieldLine(node, typeErr.Field),
+				Message: fmt.Sprintf("%s: should be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value),
+			}}
+		}
+		return mock, []Error{{Line: node.Line, Message: err.Error()}}
+	}
+
+	var errs []Error
+	for _, fe := range mock.Validate() {
+		errs = append(errs, Error{Line: fieldLine(node, fe.Field), Message: fe.Error()})
+	}
+	return mock, errs
+}
+
+// unknownFields reports the keys of the mapping which are not fields of the struct type,
+// structs nested in the mapping are checked too
+func unknownFields(node *yaml.Node, t reflect.Type, path string) []Error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	node = resolve(node)
+	if t.Kind() != reflect.Struct || node == nil {
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var errs []Error
+		for i, item := range node.Content {
+			errs = append(errs, unknownFields(item, t, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	case yaml.MappingNode:
+	default:
+		return nil
+	}
+
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+
+	var errs []Error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		field := joinField(path, key.Value)
+		ft, ok := fields[key.Value]
+		if !ok {
+			errs = append(errs, Error{Line: key.Line, Message: fmt.Sprintf("%s: unknown field", field)})
+			continue
+		}
+		errs = append(errs, unknownFields(node.Content[i+1], ft, field)...)
+	}
+	return errs
+}
+
+// toValue converts a node to the values json marshals, mapping keys are always strings
+// and timestamps are left as they were written
+func toValue(node *yaml.Node) interface{} {
+	node = resolve(node)
+	if node == nil {
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			m[node.Content[i].Value] = toValue(node.Content[i+1])
+		}
+		return m
+	case yaml.SequenceNode:
+		list := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			list[i] = toValue(item)
+		}
+		return list
+	}
+
+	if node.Tag == "!!str" || node.Tag == "!!timestamp" {
+		return node.Value
+	}
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return node.Value
+	}
+	return v
+}
+
+// fieldLine finds the line of a field given by its path e.g. `responses[1].status`, the
+// line of the closest parent found is used where the field itself is missing
+func fieldLine(node *yaml.Node, field string) int {
+	line := node.Line
+	current := resolve(node)
+
+	for _, token := range splitField(field) {
+		if current == nil {
+			break
+		}
+		switch current.Kind {
+		case yaml.MappingNode:
+			found := false
+			for i := 0; i+1 < len(current.Content); i += 2 {
+				if current.Content[i].Value == token {
+					line = current.Content[i].Line
+					current = resolve(current.Content[i+1])
+					found = true
+					break
+				}
+			}
+			if !found {
+				return line
+			}
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(current.Content) {
+				return line
+			}
+			current = resolve(current.Content[i])
+			line = current.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// splitField splits a field path to its names and indexes, `responses[1].status` is
+// `responses`, `1` and `status`
+func splitField(field string) []string {
+	var tokens []string
+	for _, part := range strings.Split(field, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if name != "" {
+			tokens = append(tokens, name)
+		}
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			tokens = append(tokens, index)
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return tokens
+}
+
+// joinField appends a name to a field path
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// mappingValue returns the value of a key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// resolve follows document and alias nodes to the node holding the content
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// syntaxError splits a yaml syntax error such as `yaml: line 3: ...` to its line and message
+func syntaxError(err error) (int, string) {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if !strings.HasPrefix(msg, "line ") {
+		return 0, msg
+	}
+	num, rest, _ := strings.Cut(strings.TrimPrefix(msg, "line "), ": ")
+	line, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, msg
+	}
+	return line, rest
+}
+
+// isMockFile reports whether the file has the extension of a mock file
+func isMockFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a mock file to the directory
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadFile(t *testing.T) {
+	testCases := []struct {
+		Name       string
+		File       string
+		Content    string
+		WantIDs    []string
+		WantErrors []string
+	}{
+		{
+			Name: "Single YAML mock",
+			File: "login.yaml",
+			Content: `id: login
+endPoint: /api/jwt/login
+request:
+  verb: POST
+response:
+  status: 200
+  rawBody: token
+`,
+			WantIDs: []string{"login"},
+		},
+		{
+			Name: "List of JSON mocks",
+			File: "mocks.json",
+			Content: `[
+	{"id": "one", "endPoint": "/one", "request": {"verb": "GET"}, "response": {"status": 200}},
+	{"id": "two", "endPoint": "/two", "request": {"verb": "GET"}, "response": {"status": 204}}
+]`,
+			WantIDs: []string{"one", "two"},
+		},
+		{
+			Name: "Mocks list and several documents",
+			File: "bundle.yml",
+			Content: `mocks:
+  - id: one
+    endPoint: /one
+    request: {verb: GET}
+    response: {status: 200}
+---
+id: two
+endPoint: /two
+request: {verb: GET}
+response:
+  status: 200
+  delay:
+    percentiles: {50: 10ms, 99: 1s}
+`,
+			WantIDs: []string{"one", "two"},
+		},
+		{
+			Name: "Invalid mocks reported by line, valid mocks loaded",
+			File: "invalid.yaml",
+			Content: `- id: good
+  endPoint: /good
+  request: {verb: GET}
+  response: {status: 200}
+- id: bad
+  endPoint: /bad
+  request:
+    verb: FETCH
+  response:
+    status: 999
+    headers:
+      X-Count: 1
+`,
+			WantIDs: []string{"good"},
+			WantErrors: []string{
+				"invalid.yaml:8: request.verb: should be one of GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, CONNECT, TRACE, got 'FETCH'",
+				"invalid.yaml:10: response.status: should be a http status code between 100 and 599, got 999",
+				"invalid.yaml:12: response.headers.X-Count: should be a string, got float64",
+			},
+		},
+		{
+			Name: "Unknown field",
+			File: "unknown.yaml",
+			Content: `endPoint: /typo
+request:
+  verb: GET
+  header: {}
+response: {status: 200}
+`,
+			WantErrors: []string{"unknown.yaml:4: request.header: unknown field"},
+		},
+		{
+			Name: "Wrong type",
+			File: "type.json",
+			Content: `{
+  "endPoint": "/type",
+  "request": {"verb": "GET"},
+  "response": {"status": "200"}
+}`,
+			WantErrors: []string{"type.json:4: response.status: should be int, got string"},
+		},
+		{
+			Name:       "Syntax error",
+			File:       "syntax.yaml",
+			Content:    "endPoint: /one\nrequest: [verb: GET\n",
+			WantErrors: []string{"syntax.yaml:1: did not find expected ',' or ']'"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := writeFile(t, dir, tc.File, tc.Content)
+
+			loaded, errs := LoadFile(file)
+
+			var ids []string
+			for _, mock := range loaded {
+				ids = append(ids, mock.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.WantIDs) {
+				t.Errorf("wrong mocks loaded: got %v want %v", ids, tc.WantIDs)
+			}
+
+			var got []string
+			for _, err := range errs {
+				got = append(got, strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)))
+			}
+			if !reflect.DeepEqual(got, tc.WantErrors) {
+				t.Errorf("wrong errors:\n got %q\nwant %q", got, tc.WantErrors)
+			}
+		})
+	}
+}
+
+func TestLoadFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "api/files.yaml", `- id: relative
+  endPoint: /relative
+  request: {verb: POST, schemaFile: schemas/order.json}
+  responses:
+    - {status: 200, bodyFile: bodies/order.json}
+- id: absolute
+  endPoint: /absolute
+  request: {verb: GET}
+  response: {status: 200, bodyFile: /srv/status.json}
+`)
+
+	loaded, errs := LoadFile(file)
+	if len(errs) > 0 || len(loaded) != 2 {
+		t.Fatalf("could not load mocks: %v", errs)
+	}
+
+	testCases := []struct {
+		Name string
+		Got  string
+		Want string
+	}{
+		{Name: "Schema file relative to the mock file", Got: loaded[0].Request.SchemaFile, Want: filepath.Join(dir, "api", "schemas", "order.json")},
+		{Name: "Body file relative to the mock file", Got: loaded[0].Responses[0].BodyFile, Want: filepath.Join(dir, "api", "bodies", "order.json")},
+		{Name: "Absolute path kept", Got: loaded[1].Response.BodyFile, Want: "/srv/status.json"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if tc.Got != tc.Want {
+				t.Errorf("wrong path: got %v want %v", tc.Got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.yaml", "")
+	b := writeFile(t, dir, "nested/b.json", "")
+	writeFile(t, dir, "nested/readme.md", "")
+	c := writeFile(t, dir, "other/c.yml", "")
+
+	got, err := Files([]string{filepath.Join(dir, "*.yaml"), filepath.Join(dir, "nested"), c, a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{a, b, c}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong files: got %v want %v", got, want)
+	}
+
+	if _, err := Files([]string{filepath.Join(dir, "missing/*.yaml")}); err == nil {
+		t.Error("wanted an error when nothing is found")
+	}
+}
@@ -0,0 +1,115 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Save writes the mocks to a YAML or JSON file, chosen by the extension of the file, as a
+// list which LoadFile reads back. The file is replaced in one step, so a watcher never
+// sees it half written
+func Save(file string, list []mocks.Mock) error {
+	if list == nil {
+		list = []mocks.Mock{}
+	}
+
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		data, err = json.MarshalIndent(list, "", "  ")
+		data = append(data, '\n')
+	case ".yaml", ".yml":
+		data, err = marshalYAML(list)
+	default:
+		return fmt.Errorf("cannot save mocks to '%s', the file should have a %s extension", file, strings.Join(extensions, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	return WriteFile(file, data)
+}
+
+// WriteFile writes the data to a temporary file beside the file and renames it over the file,
+// any missing directories are created
+func WriteFile(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// temporary files are private, the file is readable like any other
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// marshalYAML marshals the value to YAML using its json field names, in the order of the
+// struct fields
+func marshalYAML(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// json is yaml, decoding it to a node keeps the order of the fields
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	// the mocks, and their requests and responses, are structs whose empty fields are null
+	tidy(&doc, 1)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tidy clears the json flow and quoting styles from the nodes, so they are written in the
+// usual block style with scalars quoted only where they must be. Null fields are dropped from
+// the mappings of structs, to the depth given, a null in a mock's properties is kept
+func tidy(node *yaml.Node, structDepth int) {
+	node.Style = 0
+	if node.Kind == yaml.MappingNode {
+		if structDepth >= 0 {
+			content := node.Content[:0]
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i+1].Tag != "!!null" {
+					content = append(content, node.Content[i], node.Content[i+1])
+				}
+			}
+			node.Content = content
+		}
+		structDepth--
+	}
+	for _, child := range node.Content {
+		tidy(child, structDepth)
+	}
+}
@@ -0,0 +1,92 @@
+package loader
+
+import (
+	"encoding/json"
+	"github.com/spoonboy-io/ghost/internal/mocks"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	list := []mocks.Mock{
+		{
+			ID:       "login",
+			EndPoint: "/api/jwt/login",
+			Request: mocks.Request{
+				Verb:    "POST",
+				Headers: mocks.Properties{"Authorization": mocks.Properties{"$regex": "^AR-JWT .+"}},
+				Body:    mocks.Properties{"username": "admin", "remember": true, "attempts": 3.0},
+				Query:   mocks.Query{Required: mocks.Properties{"page": "1"}},
+			},
+			Response: mocks.Response{
+				StatusCode: 200,
+				Headers:    mocks.Properties{"Content-Type": "text/plain"},
+				RawBody:    "line one\nline two\n",
+				Body:       mocks.Properties{"legacy": nil},
+			},
+		},
+		{
+			ID:       "logo",
+			EndPoint: "/logo.png",
+			Request:  mocks.Request{Verb: "GET"},
+			Response: mocks.Response{StatusCode: 200, Base64Body: "iVBORw0KGgo="},
+		},
+	}
+
+	testCases := []struct {
+		Name     string
+		File     string
+		WantText []string
+		WantErr  bool
+	}{
+		{Name: "YAML", File: "recorded.yaml", WantText: []string{"- id: login\n  endPoint: /api/jwt/login\n", "page: \"1\"", "rawBody: |\n"}},
+		{Name: "JSON", File: "nested/recorded.json", WantText: []string{`"endPoint": "/api/jwt/login"`}},
+		{Name: "Unknown extension", File: "recorded.txt", WantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, tc.File)
+			err := Save(file, list)
+			if (err != nil) != tc.WantErr {
+				t.Fatalf("wrong error: got %v want error %v", err, tc.WantErr)
+			}
+			if tc.WantErr {
+				return
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.WantText {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("saved file should contain %q, got\n%s", want, data)
+				}
+			}
+
+			// no temporary files are left behind
+			entries, _ := os.ReadDir(filepath.Dir(file))
+			if len(entries) != 1 {
+				t.Errorf("wrong files in directory: got %v want 1", len(entries))
+			}
+
+			// the file loads back to the same mocks
+			loaded, errs := LoadFile(file)
+			if len(errs) > 0 {
+				t.Fatalf("saved file does not load: %v", errs)
+			}
+			for i := range loaded {
+				loaded[i].Source = ""
+			}
+			got, _ := json.Marshal(loaded)
+			want, _ := json.Marshal(list)
+			if string(got) != string(want) {
+				t.Errorf("mocks changed:\ngot  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Watch polls the files, globs and directories every interval and calls reload once they
+// have changed, including files being added or removed. A change must be stable for the
+// debounce duration before reload is called, so the several writes of an editor save lead
+// to a single reload. Watch returns when the context is done
+func Watch(ctx context.Context, paths []string, interval, debounce time.Duration, reload func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	current := fingerprint(paths)
+	pending := ""
+	changing := false
+	var since time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fp := fingerprint(paths)
+			switch {
+			case fp != current && (!changing || fp != pending):
+				// a new change, or still changing
+				changing, pending, since = true, fp, now
+			case changing && fp == current:
+				// changed back before it settled
+				changing = false
+			case changing && now.Sub(since) >= debounce:
+				changing, current = false, pending
+				reload()
+			}
+		}
+	}
+}
+
+// fingerprint describes the mock files by their path, size and modification time, so any
+// change to the set of files or their content changes the fingerprint
+func fingerprint(paths []string) string {
+	files, err := Files(paths)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing\n", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
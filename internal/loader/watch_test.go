@@ -0,0 +1,55 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "mocks.yaml", "a")
+
+	var reloads int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, []string{dir}, 10*time.Millisecond, 50*time.Millisecond, func() {
+		atomic.AddInt32(&reloads, 1)
+	})
+
+	waitFor := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&reloads) < want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// allow for any extra reloads
+		time.Sleep(100 * time.Millisecond)
+		if got := atomic.LoadInt32(&reloads); got != want {
+			t.Fatalf("wrong number of reloads: got %v want %v", got, want)
+		}
+	}
+
+	// several writes in quick succession are a single change
+	time.Sleep(30 * time.Millisecond)
+	for _, content := range []string{"ab", "abc", "abcd"} {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	waitFor(1)
+
+	// adding a file is a change
+	writeFile(t, dir, "more.json", "{}")
+	waitFor(2)
+
+	// removing a file is a change
+	if err := os.Remove(filepath.Join(dir, "more.json")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(3)
+}
@@ -4,27 +4,143 @@ package mocks
 // type Properties map[string]string
 type Properties map[string]interface{}
 
-// Request describes the data we keep about a mock request
+// Query describes the query string parameters we expect on a mock request, they are
+// matched by name after decoding so the order and encoding used by the client do not matter.
+// Required parameters must be present, optional parameters are checked only when present,
+// a nil value accepts any value. Forbidden parameters must not be present
+type Query struct {
+	Required  Properties `json:"required,omitempty"`
+	Optional  Properties `json:"optional,omitempty"`
+	Forbidden []string   `json:"forbidden,omitempty"`
+}
+
+// Assertion checks the value(s) at a path in the request body, the path is a JSONPath
+// such as `$.values['Login ID']` or a JSON Pointer such as `/values/Login ID`. The value
+// may be an exact value or an object of match operators
+type Assertion struct {
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Request describes the data we keep about a mock request, PathParams are the
+// expected values of any path parameters captured by the endpoint template.
+// BodyAssertions check individual fields of large request bodies without the
+// need to restate the whole body. The request body can also be validated against
+// a JSON Schema (draft 2020-12) given inline as Schema, or as the path of a SchemaFile
 type Request struct {
-	Verb    string     `json:"verb"`
-	Headers Properties `json:"headers"`
-	Body    Properties `json:"body"`
+	Verb           string      `json:"verb"`
+	PathParams     Properties  `json:"pathParams,omitempty"`
+	Query          Query       `json:"query,omitempty"`
+	Headers        Properties  `json:"headers"`
+	Body           Properties  `json:"body"`
+	BodyAssertions []Assertion `json:"bodyAssertions,omitempty"`
+	Schema         interface{} `json:"schema,omitempty"`
+	SchemaFile     string      `json:"schemaFile,omitempty"`
 }
 
-// Response describes the data we store about a mock response
+// Response describes the data we store about a mock response. As well as the structured
+// Body, which is marshaled to json, a response can have a raw body which is served
+// byte-for-byte with the declared content type. The raw body is given as a string
+// in RawBody, base64 encoded in Base64Body (for binary content) or as the path of a BodyFile.
+// RawBody is rendered as a template only when Template is set
+// The response is delayed by Delay, and replaced by a simulated failure by Fault, if set
 type Response struct {
 	StatusCode int        `json:"status"`
 	Headers    Properties `json:"headers"`
 	Body       Properties `json:"body"`
+	RawBody    string     `json:"rawBody,omitempty"`
+	Template   bool       `json:"template,omitempty"`
+	Base64Body string     `json:"base64Body,omitempty"`
+	BodyFile   string     `json:"bodyFile,omitempty"`
+	Delay      *Delay     `json:"delay,omitempty"`
+	Fault      *Fault     `json:"fault,omitempty"`
+}
+
+// Fault types, which simulate a failure in place of the mock response
+const (
+	// FaultConnectionReset resets the TCP connection without writing a response
+	FaultConnectionReset = "connection_reset"
+	// FaultEmptyReply closes the connection without writing a response
+	FaultEmptyReply = "empty_reply"
+	// FaultMalformedBody writes the status and headers followed by garbage bytes
+	FaultMalformedBody = "malformed_body"
+	// FaultTrickle writes the response body in small chunks at a set rate
+	FaultTrickle = "trickle"
+	// FaultStall writes the status and headers then stalls until the client gives up
+	FaultStall = "stall"
+)
+
+// Fault describes a failure to simulate when responding. Probability is the percentage
+// of responses to which the fault applies, it applies to all responses if not given. A
+// trickled body is written ChunkSize bytes (default 1) at a time every ChunkDelay (default 100ms)
+type Fault struct {
+	Type        string   `json:"type"`
+	Probability float64  `json:"probability,omitempty"`
+	ChunkSize   int      `json:"chunkSize,omitempty"`
+	ChunkDelay  Duration `json:"chunkDelay,omitempty"`
+}
+
+// Delay describes the latency to simulate before a response is sent. The Fixed duration is
+// always applied, to which a variable duration can be added, either sampled from the
+// Percentiles of a latency distribution e.g. {"p50": "100ms", "p99": "2s"}, or from a
+// lognormal distribution with the Median and Sigma (shape) given, or uniformly between Min and Max
+type Delay struct {
+	Fixed       Duration            `json:"fixed,omitempty"`
+	Min         Duration            `json:"min,omitempty"`
+	Max         Duration            `json:"max,omitempty"`
+	Median      Duration            `json:"median,omitempty"`
+	Sigma       float64             `json:"sigma,omitempty"`
+	Percentiles map[string]Duration `json:"percentiles,omitempty"`
 }
 
 // Mock represents a single mock, it's endpoint, the request, and the response
+// The endpoint may be a template containing path parameters, such as
+// `/api/arsys/v1/entry/{form}/{id}`, which match any value in that path segment.
+// Several mocks may share an endpoint and verb, they are tried in order of Priority
+// (highest first) and the first whose request expectations are met is used. An ID is
+// assigned when the mock is cached if it does not have one.
+// A mock can be part of a named Scenario, a state machine shared by the mocks in it which
+// begins in the state `Started`. Such a mock only matches when the scenario is in its
+// RequiredState (if set), and when it matches the scenario moves to its NewState (if set).
+// A mock can have a sequence of Responses instead of a single Response, successive matching
+// calls return the next response in the sequence, the SequenceMode decides what happens
+// when the sequence is used up. The Source records where the mock was loaded from, such as
+// `file:mocks/login.yaml`. A mock with ProxyTo set forwards the requests it matches to that
+// upstream base URL instead of responding, with the changes in ProxyHeaders made to the request
 type Mock struct {
-	EndPoint string   `json:"endPoint"`
-	Request  Request  `json:"request"`
-	Response Response `json:"response"`
+	ID            string        `json:"id,omitempty"`
+	Source        string        `json:"source,omitempty"`
+	Priority      int           `json:"priority,omitempty"`
+	Scenario      string        `json:"scenario,omitempty"`
+	RequiredState string        `json:"requiredState,omitempty"`
+	NewState      string        `json:"newState,omitempty"`
+	EndPoint      string        `json:"endPoint"`
+	Request       Request       `json:"request"`
+	Response      Response      `json:"response"`
+	Responses     []Response    `json:"responses,omitempty"`
+	SequenceMode  string        `json:"sequenceMode,omitempty"`
+	ProxyTo       string        `json:"proxyTo,omitempty"`
+	ProxyHeaders  *ProxyHeaders `json:"proxyHeaders,omitempty"`
 }
 
+// ProxyHeaders are the changes made to the headers of a request forwarded to an upstream,
+// the Remove headers are removed and then the Add headers are set
+type ProxyHeaders struct {
+	Add    Properties `json:"add,omitempty"`
+	Remove []string   `json:"remove,omitempty"`
+}
+
+// Sequence modes decide which response a mock with a sequence of responses returns once
+// every response in the sequence has been returned
+const (
+	// SequenceStick repeats the last response, it is the default
+	SequenceStick = "stick"
+	// SequenceCycle starts again from the first response
+	SequenceCycle = "cycle"
+	// SequenceFallThrough stops the mock matching so the next candidate mock is tried
+	SequenceFallThrough = "fallthrough"
+)
+
 // Mocker is simple interface to describe the values which can load a suite of mocks
 // New packages can be created which implement this interface to preload mocks to the cache
 // such that they do not need to be individually loaded to the server via POST request
@@ -0,0 +1,166 @@
+package mocks
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FieldError describes a problem with a field of a mock, the Field is the path to it
+// using the json names e.g. `response.status` or `responses[1].headers.Location`
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// verbs are the request methods a mock can match
+var verbs = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+// Validate checks the mock can be matched and its responses served, it returns a
+// FieldError for each problem found
+func (m Mock) Validate() []FieldError {
+	var errs []FieldError
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if strings.TrimSpace(m.EndPoint) == "" {
+		add("endPoint", "is required")
+	}
+
+	if m.Request.Verb == "" {
+		add("request.verb", "is required")
+	} else if !contains(verbs, strings.ToUpper(m.Request.Verb)) {
+		add("request.verb", "should be one of %s, got '%s'", strings.Join(verbs, ", "), m.Request.Verb)
+	}
+
+	switch m.SequenceMode {
+	case "", SequenceStick, SequenceCycle, SequenceFallThrough:
+	default:
+		add("sequenceMode", "should be one of %s, %s or %s, got '%s'", SequenceStick, SequenceCycle, SequenceFallThrough, m.SequenceMode)
+	}
+
+	if m.ProxyTo != "" {
+		if u, err := url.Parse(m.ProxyTo); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("proxyTo", "should be an absolute http or https url, got '%s'", m.ProxyTo)
+		}
+	}
+	if m.ProxyHeaders != nil {
+		for _, k := range sortedKeys(m.ProxyHeaders.Add) {
+			if _, ok := m.ProxyHeaders.Add[k].(string); !ok {
+				add("proxyHeaders.add."+k, "should be a string, got %T", m.ProxyHeaders.Add[k])
+			}
+		}
+	}
+
+	// the response of a proxying mock comes from the upstream
+	if len(m.Responses) == 0 && m.ProxyTo == "" {
+		errs = append(errs, m.Response.validate("response")...)
+	}
+	for i, response := range m.Responses {
+		errs = append(errs, response.validate(fmt.Sprintf("responses[%d]", i))...)
+	}
+	return errs
+}
+
+// ValidateRemote checks a mock received from a client over the api, as Validate does. Such
+// a mock cannot refer to files on the server, as any client could then read them, so a
+// bodyFile or schemaFile is only allowed in mocks loaded from files or packages
+func (m Mock) ValidateRemote() []FieldError {
+	errs := m.Validate()
+	if m.Request.SchemaFile != "" {
+		errs = append(errs, FieldError{Field: "request.schemaFile", Message: "is only allowed in mocks loaded from files or packages"})
+	}
+	if m.Response.BodyFile != "" {
+		errs = append(errs, FieldError{Field: "response.bodyFile", Message: "is only allowed in mocks loaded from files or packages"})
+	}
+	for i, response := range m.Responses {
+		if response.BodyFile != "" {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("responses[%d].bodyFile", i), Message: "is only allowed in mocks loaded from files or packages"})
+		}
+	}
+	return errs
+}
+
+// validate checks the response can be served, field names are prefixed with the path
+func (r Response) validate(path string) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, FieldError{Field: path + "." + field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if r.StatusCode < 100 || r.StatusCode > 599 {
+		add("status", "should be a http status code between 100 and 599, got %d", r.StatusCode)
+	}
+
+	for _, k := range sortedKeys(r.Headers) {
+		if _, ok := r.Headers[k].(string); !ok {
+			add("headers."+k, "should be a string, got %T", r.Headers[k])
+		}
+	}
+
+	if r.Base64Body != "" {
+		if _, err := base64.StdEncoding.DecodeString(r.Base64Body); err != nil {
+			add("base64Body", "should be base64 encoded (%v)", err)
+		}
+	}
+
+	if r.Delay != nil {
+		if r.Delay.Max > 0 && r.Delay.Max < r.Delay.Min {
+			add("delay.max", "should not be less than the minimum")
+		}
+		if r.Delay.Sigma < 0 {
+			add("delay.sigma", "should not be negative")
+		}
+	}
+
+	if r.Fault != nil {
+		switch r.Fault.Type {
+		case FaultConnectionReset, FaultEmptyReply, FaultMalformedBody, FaultTrickle, FaultStall:
+		default:
+			add("fault.type", "should be one of %s, %s, %s, %s or %s, got '%s'",
+				FaultConnectionReset, FaultEmptyReply, FaultMalformedBody, FaultTrickle, FaultStall, r.Fault.Type)
+		}
+		if r.Fault.Probability < 0 || r.Fault.Probability > 100 {
+			add("fault.probability", "should be a percentage, got %g", r.Fault.Probability)
+		}
+	}
+	return errs
+}
+
+// sortedKeys returns the keys of the properties in order, so errors are reported in a stable order
+func sortedKeys(p Properties) []string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}